@@ -49,6 +49,24 @@ var (
 
 	certDir = flag.String("cert-dir", "",
 		"Directory for TLS certificates")
+
+	resyncPeriod = flag.Duration("chartassignment-resync-period", chartassignment.DefaultResyncPeriod,
+		"Interval at which ChartAssignments are reconciled without changes to them or their resources")
+
+	requeuePeriod = flag.Duration("chartassignment-requeue-period", chartassignment.DefaultRequeuePeriod,
+		"Interval at which ChartAssignments are reconciled while their release is in progress")
+
+	manifestHistory = flag.Int("chartassignment-manifest-history", chartassignment.DefaultManifestHistory,
+		"Number of generations whose applied manifests are kept for each ChartAssignment, negative values disable the history")
+
+	allowSystemNamespaces = flag.Bool("chartassignment-allow-system-namespaces", false,
+		"Whether ChartAssignments and AppRollouts may list system namespaces such as kube-system in allowedNamespaces")
+
+	robotDeletionGracePeriod = flag.Duration("approllout-robot-deletion-grace-period", approllout.DefaultRobotDeletionGracePeriod,
+		"Time for which the ChartAssignments of a deleted Robot are kept in case it reappears, negative values delete them right away")
+
+	metricsBindAddress = flag.String("metrics-bind-address", ":8081",
+		"Address the Prometheus metrics of the controllers are served on, \"0\" disables them")
 )
 
 func main() {
@@ -88,23 +106,30 @@ func setupAppV2(cfg *rest.Config, params map[string]interface{}) error {
 	mgr, err := manager.New(cfg, manager.Options{
 		Scheme:             sc,
 		Port:               *webhookPort,
-		MetricsBindAddress: "0", // disabled
+		MetricsBindAddress: *metricsBindAddress,
 	})
 	if err != nil {
 		return errors.Wrap(err, "create controller manager")
 	}
-	if err := chartassignment.Add(mgr, *cluster); err != nil {
+	if err := chartassignment.Add(mgr, *cluster, chartassignment.Options{
+		ResyncPeriod:    *resyncPeriod,
+		RequeuePeriod:   *requeuePeriod,
+		ManifestHistory: *manifestHistory,
+	}); err != nil {
 		return errors.Wrap(err, "add ChartAssignment controller")
 	}
-	if err := approllout.Add(mgr, chartutil.Values(params)); err != nil {
-		return errors.Wrap(err, "add AppRollout controller")
+	if err := approllout.Add(mgr, chartutil.Values(params), approllout.Options{
+		RobotDeletionGracePeriod: *robotDeletionGracePeriod,
+	}); err != nil {
+		return errors.Wrap(err, "add AppRollout and AppBundle controllers")
 	}
 
 	srv := mgr.GetWebhookServer()
 	srv.CertDir = *certDir
 
-	srv.Register("/approllout/validate", approllout.NewValidationWebhook(mgr))
-	srv.Register("/chartassignment/validate", chartassignment.NewValidationWebhook(mgr))
+	srv.Register("/approllout/validate", approllout.NewValidationWebhook(mgr, chartutil.Values(params), *allowSystemNamespaces))
+	srv.Register("/appbundle/validate", approllout.NewBundleValidationWebhook(mgr))
+	srv.Register("/chartassignment/validate", chartassignment.NewValidationWebhook(mgr, *allowSystemNamespaces))
 
 	go func() {
 		if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
@@ -0,0 +1,190 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kubectl-approllout is a kubectl plugin to preview the ChartAssignments
+// that an AppRollout creates, updates, and deletes before applying it.
+//
+//	kubectl approllout preview -f my-rollout.yaml
+//	kubectl approllout preview -f my-rollout.yaml --values
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/googlecloudrobotics/core/src/go/pkg/controller/approllout"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/strvals"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	filename    string
+	params      string
+	printValues bool
+
+	cmdRoot = &cobra.Command{
+		Use:   "kubectl-approllout",
+		Short: "Preview the effects of AppRollouts.",
+	}
+	cmdPreview = &cobra.Command{
+		Use:   "preview -f FILENAME",
+		Short: "Print the ChartAssignments that applying the AppRollout creates, updates, and deletes.",
+		Args:  cobra.NoArgs,
+		RunE:  runPreview,
+	}
+
+	restOpts = genericclioptions.NewConfigFlags(true)
+)
+
+func main() {
+	restOpts.AddFlags(cmdRoot.PersistentFlags())
+
+	cmdPreview.Flags().StringVarP(&filename, "filename", "f", "", "file with the AppRollout, \"-\" reads from stdin")
+	cmdPreview.Flags().StringVar(&params, "params", "", "base values of the charts formatted as name=value,topname.subname=value, by default the ones of the cloud-master")
+	cmdPreview.Flags().BoolVar(&printValues, "values", false, "print the values of all ChartAssignments, not only the created ones")
+	cmdPreview.MarkFlagRequired("filename")
+
+	cmdRoot.AddCommand(cmdPreview)
+
+	cmdRoot.SilenceUsage = true
+	if err := cmdRoot.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func readRollout(filename string) (*apps.AppRollout, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if filename == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read AppRollout")
+	}
+	var ar apps.AppRollout
+	if err := yaml.UnmarshalStrict(b, &ar); err != nil {
+		return nil, errors.Wrap(err, "decode AppRollout")
+	}
+	if ar.Name == "" {
+		return nil, errors.New("AppRollout has no name")
+	}
+	return &ar, nil
+}
+
+// cloudMasterParams returns the base values that the cloud-master in the
+// given namespace passes to the charts, which are set in its --params flag.
+func cloudMasterParams(kube kubernetes.Interface, namespace string) (chartutil.Values, error) {
+	d, err := kube.AppsV1().Deployments(namespace).Get("cloud-master", metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get cloud-master Deployment, use --params to set the base values")
+	}
+	for _, c := range d.Spec.Template.Spec.Containers {
+		for _, arg := range c.Args {
+			if p := strings.TrimPrefix(arg, "--params="); p != arg {
+				return strvals.ParseString(p)
+			}
+		}
+	}
+	return chartutil.Values{}, nil
+}
+
+func runPreview(cmd *cobra.Command, args []string) error {
+	ar, err := readRollout(filename)
+	if err != nil {
+		return err
+	}
+	cfg, err := restOpts.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "get config")
+	}
+	sc := runtime.NewScheme()
+	apps.AddToScheme(sc)
+	registry.AddToScheme(sc)
+
+	kube, err := kclient.New(cfg, kclient.Options{Scheme: sc})
+	if err != nil {
+		return errors.Wrap(err, "create client")
+	}
+	var baseValues chartutil.Values
+	if params != "" {
+		if baseValues, err = strvals.ParseString(params); err != nil {
+			return errors.Wrap(err, "invalid --params")
+		}
+	} else {
+		k8s, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return errors.Wrap(err, "create client")
+		}
+		// The namespace of the cloud-master is taken from --namespace or
+		// the kubeconfig context, "default" if neither sets it.
+		namespace, _, err := restOpts.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return errors.Wrap(err, "get namespace")
+		}
+		if baseValues, err = cloudMasterParams(k8s, namespace); err != nil {
+			return err
+		}
+	}
+	entries, err := approllout.Preview(context.Background(), kube, ar, baseValues)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tCHARTASSIGNMENT\tCLUSTER")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.Action, e.Name(), e.ClusterName())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Print the rendered values of created ChartAssignments and the diff
+	// of updated ones.
+	for _, e := range entries {
+		if e.Action == approllout.PreviewUpdate {
+			diff, err := e.Diff()
+			if err != nil {
+				return errors.Wrapf(err, "diff ChartAssignment %q", e.Name())
+			}
+			fmt.Printf("\n# %s %s (-current +new)\n%s", e.Action, e.Name(), diff)
+		}
+		if e.Want != nil && (e.Action == approllout.PreviewCreate || printValues) {
+			b, err := yaml.Marshal(e.Want.Spec.Chart.Values)
+			if err != nil {
+				return errors.Wrapf(err, "encode values of ChartAssignment %q", e.Name())
+			}
+			fmt.Printf("\n# values of %s\n%s", e.Name(), b)
+		}
+	}
+	return nil
+}
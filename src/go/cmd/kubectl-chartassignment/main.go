@@ -0,0 +1,140 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// kubectl-chartassignment is a kubectl plugin to inspect the manifests that
+// were applied for the generations of a ChartAssignment.
+//
+//	kubectl chartassignment history my-app-cloud
+//	kubectl chartassignment manifests my-app-cloud --generation 3
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/googlecloudrobotics/core/src/go/pkg/controller/chartassignment"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+)
+
+var (
+	generation int64
+
+	cmdRoot = &cobra.Command{
+		Use:   "kubectl-chartassignment",
+		Short: "Inspect the manifest history of ChartAssignments.",
+	}
+	cmdHistory = &cobra.Command{
+		Use:   "history NAME",
+		Short: "List the generations whose manifests are kept.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runHistory,
+	}
+	cmdManifests = &cobra.Command{
+		Use:   "manifests NAME",
+		Short: "Print the manifests applied for a generation, by default the latest one.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runManifests,
+	}
+
+	restOpts = genericclioptions.NewConfigFlags(true)
+)
+
+func main() {
+	restOpts.AddFlags(cmdRoot.PersistentFlags())
+
+	cmdManifests.Flags().Int64Var(&generation, "generation", 0, "generation of the ChartAssignment to print the manifests of")
+
+	cmdRoot.AddCommand(cmdHistory)
+	cmdRoot.AddCommand(cmdManifests)
+
+	cmdRoot.SilenceUsage = true
+	if err := cmdRoot.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// listHistory returns the Secrets holding the manifest history of the
+// ChartAssignment, newest first.
+func listHistory(name string) ([]core.Secret, error) {
+	cfg, err := restOpts.ToRESTConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "get config")
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "create client")
+	}
+	// The Secrets are in the ChartAssignment's namespace, which we don't
+	// need to look up when listing across namespaces.
+	list, err := kube.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", chartassignment.LabelManifestsChartAssignment, name),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list Secrets")
+	}
+	if len(list.Items) == 0 {
+		return nil, errors.Errorf("no manifest history found for ChartAssignment %q", name)
+	}
+	chartassignment.SortManifestHistory(list.Items)
+	return list.Items, nil
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	secrets, err := listHistory(args[0])
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "GENERATION\tNAMESPACE\tSECRET\tAPPLIED")
+	for _, s := range secrets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			s.Labels[chartassignment.LabelManifestsGeneration], s.Namespace, s.Name,
+			s.CreationTimestamp.Format("2006-01-02 15:04:05 MST"))
+	}
+	return w.Flush()
+}
+
+func runManifests(cmd *cobra.Command, args []string) error {
+	secrets, err := listHistory(args[0])
+	if err != nil {
+		return err
+	}
+	s := &secrets[0]
+	if generation != 0 {
+		s = nil
+		for i := range secrets {
+			if secrets[i].Labels[chartassignment.LabelManifestsGeneration] == strconv.FormatInt(generation, 10) {
+				s = &secrets[i]
+				break
+			}
+		}
+		if s == nil {
+			return errors.Errorf("no manifests found for generation %d of ChartAssignment %q", generation, args[0])
+		}
+	}
+	manifests, err := chartassignment.DecodeManifests(s)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(manifests)
+	return err
+}
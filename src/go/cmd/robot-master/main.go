@@ -47,6 +47,21 @@ var (
 	certDir = flag.String("cert-dir", "",
 		"Directory for TLS certificates")
 
+	resyncPeriod = flag.Duration("chartassignment-resync-period", chartassignment.DefaultResyncPeriod,
+		"Interval at which ChartAssignments are reconciled without changes to them or their resources")
+
+	requeuePeriod = flag.Duration("chartassignment-requeue-period", chartassignment.DefaultRequeuePeriod,
+		"Interval at which ChartAssignments are reconciled while their release is in progress")
+
+	manifestHistory = flag.Int("chartassignment-manifest-history", chartassignment.DefaultManifestHistory,
+		"Number of generations whose applied manifests are kept for each ChartAssignment, negative values disable the history")
+
+	allowSystemNamespaces = flag.Bool("chartassignment-allow-system-namespaces", false,
+		"Whether ChartAssignments may list system namespaces such as kube-system in allowedNamespaces")
+
+	metricsBindAddress = flag.String("metrics-bind-address", ":8081",
+		"Address the Prometheus metrics of the controllers are served on, \"0\" disables them")
+
 	stackdriverProjectID = flag.String("trace-stackdriver-project-id", "",
 		"If not empty, traces will be uploaded to this Google Cloud Project")
 
@@ -103,19 +118,23 @@ func setupAppV2(cfg *rest.Config, cluster string) error {
 	mgr, err := manager.New(cfg, manager.Options{
 		Scheme:             sc,
 		Port:               *webhookPort,
-		MetricsBindAddress: "0", // disabled
+		MetricsBindAddress: *metricsBindAddress,
 	})
 	if err != nil {
 		return errors.Wrap(err, "create controller manager")
 	}
-	if err := chartassignment.Add(mgr, cluster); err != nil {
+	if err := chartassignment.Add(mgr, cluster, chartassignment.Options{
+		ResyncPeriod:    *resyncPeriod,
+		RequeuePeriod:   *requeuePeriod,
+		ManifestHistory: *manifestHistory,
+	}); err != nil {
 		return errors.Wrap(err, "add ChartAssignment controller")
 	}
 	if *webhookEnabled {
 		srv := mgr.GetWebhookServer()
 		srv.CertDir = *certDir
 
-		webhook := chartassignment.NewValidationWebhookForEdgeCluster(mgr, cluster)
+		webhook := chartassignment.NewValidationWebhookForEdgeCluster(mgr, cluster, *allowSystemNamespaces)
 		srv.Register("/chartassignment/validate", webhook)
 	}
 
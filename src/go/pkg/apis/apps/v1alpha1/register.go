@@ -49,6 +49,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&AppList{},
 		&AppRollout{},
 		&AppRolloutList{},
+		&AppBundle{},
+		&AppBundleList{},
 		&ChartAssignment{},
 		&ChartAssignmentList{},
 		&ResourceSet{},
@@ -18,6 +18,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // +genclient
@@ -122,6 +123,18 @@ type AppSpec struct {
 	Repository string        `json:"repository"`
 	Version    string        `json:"version"`
 	Components AppComponents `json:"components"`
+	// Channels are named versions of the app, e.g. "stable" and "beta",
+	// which AppRollouts can select instead of the version above.
+	Channels []AppChannel `json:"channels,omitempty"`
+}
+
+// AppChannel is a named version of an App with its own components.
+type AppChannel struct {
+	Name string `json:"name"`
+	// Repository defaults to the one of the App.
+	Repository string        `json:"repository,omitempty"`
+	Version    string        `json:"version,omitempty"`
+	Components AppComponents `json:"components"`
 }
 
 type AppComponents struct {
@@ -159,17 +172,135 @@ type AppRolloutSpec struct {
 	AppName string                `json:"appName,omitempty"`
 	Cloud   AppRolloutSpecCloud   `json:"cloud,omitempty"`
 	Robots  []AppRolloutSpecRobot `json:"robots,omitempty"`
+	// Paused stops the controller from creating, updating, or deleting
+	// the rollout's ChartAssignments.
+	Paused bool `json:"paused,omitempty"`
+	// Schedule defers applying the spec until its activation time.
+	Schedule *AppRolloutSchedule `json:"schedule,omitempty"`
+	// DependsOn lists AppRollouts whose ChartAssignments must be Ready
+	// before the ones of this rollout are applied to the same cluster.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Strategy rolls out changes to the robots in batches. If unset, all
+	// robots are updated at once.
+	Strategy *AppRolloutStrategy `json:"strategy,omitempty"`
+	// FailurePolicy halts the rollout if too many robots fail.
+	FailurePolicy *AppRolloutFailurePolicy `json:"failurePolicy,omitempty"`
+	// SelectorOverlap decides which of several entries of Robots with the
+	// same priority selects a robot that matches all of them. Defaults to
+	// Reject.
+	SelectorOverlap SelectorOverlapPolicy `json:"selectorOverlap,omitempty"`
+}
+
+type SelectorOverlapPolicy string
+
+const (
+	// SelectorOverlapReject fails the rollout if a robot matches several
+	// entries with the highest priority.
+	SelectorOverlapReject SelectorOverlapPolicy = "Reject"
+	// SelectorOverlapFirstMatch selects the robot by the first of them.
+	SelectorOverlapFirstMatch SelectorOverlapPolicy = "FirstMatch"
+)
+
+// AppRolloutSchedule defers applying the spec of an AppRollout. Until the
+// activation time, the controller leaves the existing ChartAssignments
+// untouched.
+type AppRolloutSchedule struct {
+	// ActivationTime is when the controller starts applying the spec.
+	ActivationTime metav1.Time `json:"activationTime"`
+}
+
+// AppRolloutFailurePolicy halts a rollout once more robot ChartAssignments
+// of the current generation failed than allowed. A halted rollout leaves its
+// ChartAssignments untouched until the AppRollout changes.
+type AppRolloutFailurePolicy struct {
+	// MaxFailed is the number or percentage of robots whose ChartAssignments
+	// may fail without halting the rollout. Defaults to 0.
+	MaxFailed *intstr.IntOrString `json:"maxFailed,omitempty"`
+	// Rollback re-applies the last spec whose ChartAssignments all became
+	// Ready once the rollout is halted.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// AppRolloutStrategy configures how changes of an AppRollout are rolled out
+// to its robots. Robots are updated in batches, in the order of their names.
+// The next batch starts once all ChartAssignments of the previous batch are
+// Ready. The cloud ChartAssignment is updated right away.
+type AppRolloutStrategy struct {
+	// Canary is the number or percentage of robots in the first batch.
+	// Defaults to BatchSize.
+	Canary *intstr.IntOrString `json:"canary,omitempty"`
+	// BatchSize is the number or percentage of robots in each following
+	// batch. Defaults to all remaining robots.
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+	// DeadlineSeconds is the time a batch has to become Ready before the
+	// rollout is halted. Defaults to 10 minutes.
+	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
 }
 
 type AppRolloutSpecCloud struct {
-	Values ConfigValues `json:"values,omitempty"`
+	// Channel of the App to roll out. Defaults to the App's version.
+	Channel    string                    `json:"channel,omitempty"`
+	Values     ConfigValues              `json:"values,omitempty"`
+	ValuesFrom []ValuesFromSource        `json:"valuesFrom,omitempty"`
+	ImagePull  *ChartAssignmentImagePull `json:"imagePull,omitempty"`
+	Namespace  *ChartAssignmentNamespace `json:"namespace,omitempty"`
+	// AllowedNamespaces are passed to the ChartAssignments.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
 }
 
 type AppRolloutSpecRobot struct {
 	Selector *RobotSelector `json:"selector,omitempty"`
+	// Priority of the entry if a robot matches several entries. The robot
+	// is selected by the entry with the highest priority.
+	Priority int32 `json:"priority,omitempty"`
+	// Channel of the App to roll out. Defaults to the App's version.
+	Channel string `json:"channel,omitempty"`
+
+	Values ConfigValues `json:"values,omitempty"`
+	// ValuesTemplate are values whose strings are rendered as templates
+	// with the values of each selected robot, e.g. "{{ .robot.name }}".
+	// They override Values.
+	ValuesTemplate ConfigValues              `json:"valuesTemplate,omitempty"`
+	ValuesFrom     []ValuesFromSource        `json:"valuesFrom,omitempty"`
+	Version        string                    `json:"version,omitempty"`
+	Rollback       *ChartAssignmentRollback  `json:"rollback,omitempty"`
+	ImagePull      *ChartAssignmentImagePull `json:"imagePull,omitempty"`
+	Namespace      *ChartAssignmentNamespace `json:"namespace,omitempty"`
+	// AllowedNamespaces are passed to the ChartAssignments.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// UpdatePolicy restricts when the ChartAssignments of the selected
+	// robots are created or updated.
+	UpdatePolicy *RobotUpdatePolicy `json:"updatePolicy,omitempty"`
+}
 
-	Values  ConfigValues `json:"values,omitempty"`
-	Version string       `json:"version,omitempty"`
+// RobotUpdatePolicy delays changes of a robot's ChartAssignment until the
+// robot can be safely updated. Deletions are not delayed.
+type RobotUpdatePolicy struct {
+	// MaintenanceWindows restrict updates to the given time ranges. If
+	// empty, robots may be updated at any time.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// RequireIdle delays updates while the robot's status.robot.state is not
+	// AVAILABLE or it is executing a mission. Whatever executes missions on
+	// the robot marks this by setting the annotation
+	// "cloudrobotics.com/active-mission" on the Robot to the mission's name
+	// and removing it once the mission is done.
+	RequireIdle bool `json:"requireIdle,omitempty"`
+}
+
+// MaintenanceWindow is a daily time range on the given days of the week.
+// Instead of full cron expressions, windows are limited to one time range
+// that starts at the same time on each of the days.
+type MaintenanceWindow struct {
+	// Days of the week on which the window starts, e.g. "Sat". Defaults to
+	// all days.
+	Days []string `json:"days,omitempty"`
+	// Start and End of the window as "HH:MM". If End is before Start, the
+	// window ends on the next day.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// TimeZone is the IANA time zone of Start and End, e.g.
+	// "Europe/Berlin". Defaults to UTC.
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 type RobotSelector struct {
@@ -185,6 +316,96 @@ type AppRolloutStatus struct {
 	SettledAssignments int64                 `json:"settledAssignments"`
 	ReadyAssignments   int64                 `json:"readyAssignments"`
 	FailedAssignments  int64                 `json:"failedAssignments"`
+	// Rollout tracks the progress of rolling out the current generation
+	// if spec.strategy is set.
+	Rollout *AppRolloutProgress `json:"rollout,omitempty"`
+	// HaltedGeneration is the generation whose rollout was halted, either
+	// by the failure policy or because a batch missed its deadline.
+	HaltedGeneration int64 `json:"haltedGeneration,omitempty"`
+	// LastReady is the last spec whose ChartAssignments all became Ready.
+	LastReady *AppRolloutLastReady `json:"lastReady,omitempty"`
+	// DeletedRobots are robots that no longer exist, but whose
+	// ChartAssignments are kept for a grace period in case they reappear.
+	DeletedRobots []AppRolloutDeletedRobot `json:"deletedRobots,omitempty"`
+	// WaitingRobots are the robots whose ChartAssignments wait for their
+	// update policy to allow the update. At most 20 robots are listed.
+	WaitingRobots []AppRolloutWaitingRobot `json:"waitingRobots,omitempty"`
+	// Robots lists the robots that matched several entries of spec.robots
+	// and the entry that selected them, sorted by name. At most 20 robots
+	// are listed.
+	Robots []AppRolloutRobotStatus `json:"robots,omitempty"`
+	// OverlappingRobots is the number of robots that matched several
+	// entries of spec.robots.
+	OverlappingRobots int64 `json:"overlappingRobots,omitempty"`
+	// UnreadyClusters lists a bounded number of clusters whose
+	// ChartAssignments are not Ready. Failed ones come first, then they
+	// are sorted by name.
+	UnreadyClusters []AppRolloutUnreadyCluster `json:"unreadyClusters,omitempty"`
+	// Summary of the ChartAssignments' phases, e.g. "298/300 ready, 2 failed".
+	Summary string `json:"summary,omitempty"`
+}
+
+// AppRolloutUnreadyCluster describes a cluster whose ChartAssignment is not
+// Ready.
+type AppRolloutUnreadyCluster struct {
+	// Name of the cluster, which is the robot name or "cloud".
+	Name  string               `json:"name"`
+	Phase ChartAssignmentPhase `json:"phase,omitempty"`
+	// Message of the ChartAssignment's first condition that isn't true.
+	Message string `json:"message,omitempty"`
+}
+
+// AppRolloutRobotStatus describes a robot that matched several entries of an
+// AppRollout.
+type AppRolloutRobotStatus struct {
+	Name string `json:"name"`
+	// Entry is the index of the entry in spec.robots that selected the
+	// robot.
+	Entry int32 `json:"entry"`
+}
+
+// AppRolloutWaitingRobot is a robot whose update is delayed.
+type AppRolloutWaitingRobot struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// AppRolloutDeletedRobot is a robot whose ChartAssignments are kept after it
+// was deleted.
+type AppRolloutDeletedRobot struct {
+	Name string `json:"name"`
+	// DeletionTime is when the robot was first found to be deleted.
+	DeletionTime metav1.Time `json:"deletionTime"`
+}
+
+// AppRolloutLastReady records a spec of an AppRollout that was rolled out
+// successfully, so that a halted rollout can return to it.
+type AppRolloutLastReady struct {
+	Generation int64          `json:"generation"`
+	Spec       AppRolloutSpec `json:"spec"`
+	// Channels are the channels of the App that Spec uses, as they were
+	// when it became Ready. Rolling back uses them instead of the App's
+	// current channels, which may have been changed since.
+	Channels []AppChannel `json:"channels,omitempty"`
+}
+
+// AppRolloutProgress tracks the batches in which a generation of an
+// AppRollout is rolled out to its robots.
+type AppRolloutProgress struct {
+	// Generation of the AppRollout that is rolled out.
+	Generation int64 `json:"generation"`
+	// Batch is the number of the current batch, starting at 1.
+	Batch int32 `json:"batch"`
+	// Robots of the current batch.
+	Robots []string `json:"robots,omitempty"`
+	// BatchStartTime is when the ChartAssignments of the current batch
+	// were last created or updated.
+	BatchStartTime metav1.Time `json:"batchStartTime,omitempty"`
+	// UpdatedRobots is the number of robots whose ChartAssignments match
+	// the current generation.
+	UpdatedRobots int64 `json:"updatedRobots"`
+	// PendingRobots is the number of robots that wait for a later batch.
+	PendingRobots int64 `json:"pendingRobots"`
 }
 
 type AppRolloutCondition struct {
@@ -200,6 +421,102 @@ type AppRolloutConditionType string
 const (
 	AppRolloutConditionSettled AppRolloutConditionType = "Settled"
 	AppRolloutConditionReady   AppRolloutConditionType = "Ready"
+	AppRolloutConditionPaused  AppRolloutConditionType = "Paused"
+	// Progressing is true while batches of the current generation are
+	// rolled out and false once the rollout completed or halted.
+	AppRolloutConditionProgressing AppRolloutConditionType = "Progressing"
+	// Halted is true while the rollout of the current generation is halted.
+	AppRolloutConditionHalted AppRolloutConditionType = "Halted"
+	// Pending is true while the spec waits for the activation time of its
+	// schedule.
+	AppRolloutConditionPending AppRolloutConditionType = "Pending"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AppBundle groups Apps that are rolled out together to the same robots.
+// An AppRollout is created for each of its apps.
+type AppBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AppBundleSpec   `json:"spec,omitempty"`
+	Status AppBundleStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type AppBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []AppBundle `json:"items"`
+}
+
+type AppBundleSpec struct {
+	Apps []AppBundleApp `json:"apps,omitempty"`
+	// Robots select the robots for all apps. Their values are merged with
+	// the robot values of each app.
+	Robots []AppRolloutSpecRobot `json:"robots,omitempty"`
+	// Paused, Schedule, Strategy, FailurePolicy and SelectorOverlap are
+	// passed to the AppRollouts.
+	Paused          bool                     `json:"paused,omitempty"`
+	Schedule        *AppRolloutSchedule      `json:"schedule,omitempty"`
+	Strategy        *AppRolloutStrategy      `json:"strategy,omitempty"`
+	FailurePolicy   *AppRolloutFailurePolicy `json:"failurePolicy,omitempty"`
+	SelectorOverlap SelectorOverlapPolicy    `json:"selectorOverlap,omitempty"`
+}
+
+// AppBundleApp is an app of a bundle, which is rolled out by the AppRollout
+// "<bundle>-<name>".
+type AppBundleApp struct {
+	Name string `json:"name"`
+	// AppName is the App to roll out, which pins its version.
+	AppName string              `json:"appName"`
+	Cloud   AppRolloutSpecCloud `json:"cloud,omitempty"`
+	// RobotValues are passed to the robot chart of the app on all robots.
+	RobotValues ConfigValues `json:"robotValues,omitempty"`
+	// DependsOn lists the names of other apps of the bundle whose
+	// ChartAssignments must be Ready first.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+type AppBundleStatus struct {
+	ObservedGeneration int64                `json:"observedGeneration,omitempty"`
+	Conditions         []AppBundleCondition `json:"conditions,omitempty"`
+	// Apps has the status of the AppRollout of each app.
+	Apps []AppBundleAppStatus `json:"apps,omitempty"`
+	// Summary of all apps, e.g. "2/3 apps ready".
+	Summary string `json:"summary,omitempty"`
+}
+
+type AppBundleAppStatus struct {
+	Name              string `json:"name"`
+	Rollout           string `json:"rollout"`
+	Assignments       int64  `json:"assignments"`
+	ReadyAssignments  int64  `json:"readyAssignments"`
+	FailedAssignments int64  `json:"failedAssignments"`
+	Ready             bool   `json:"ready"`
+	Summary           string `json:"summary,omitempty"`
+}
+
+type AppBundleCondition struct {
+	Type               AppBundleConditionType `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	LastUpdateTime     metav1.Time            `json:"lastUpdateTime,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
+
+type AppBundleConditionType string
+
+const (
+	// Settled is true once the AppRollouts of all apps were applied.
+	AppBundleConditionSettled AppBundleConditionType = "Settled"
+	// Ready is true once the AppRollouts of all apps are Ready.
+	AppBundleConditionReady AppBundleConditionType = "Ready"
 )
 
 // +genclient
@@ -224,19 +541,97 @@ type ChartAssignmentList struct {
 }
 
 type ChartAssignmentSpec struct {
-	ClusterName   string        `json:"clusterName"`
-	NamespaceName string        `json:"namespaceName"`
-	Chart         AssignedChart `json:"chart"`
+	ClusterName   string                    `json:"clusterName"`
+	NamespaceName string                    `json:"namespaceName"`
+	Chart         AssignedChart             `json:"chart"`
+	Rollback      *ChartAssignmentRollback  `json:"rollback,omitempty"`
+	ImagePull     *ChartAssignmentImagePull `json:"imagePull,omitempty"`
+	Namespace     *ChartAssignmentNamespace `json:"namespace,omitempty"`
+	// AllowedNamespaces are existing namespaces the chart may create
+	// resources in besides NamespaceName and kube-system.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+	// Paused stops the controller from applying the chart. Resources that
+	// are already installed are left untouched.
+	Paused bool `json:"paused,omitempty"`
+	// DependsOn lists ChartAssignments for the same cluster that must be
+	// Ready before a new generation of the chart is applied.
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// ChartAssignmentImagePull configures the image pull secrets of the default
+// ServiceAccount in the ChartAssignment's namespace. If it is unset, the
+// gcr.io pull secret is attached on robot clusters.
+type ChartAssignmentImagePull struct {
+	// Disabled leaves the default ServiceAccount untouched.
+	Disabled bool `json:"disabled,omitempty"`
+	// Registries the chart pulls images from that require credentials.
+	Registries []ImagePullRegistry `json:"registries,omitempty"`
+}
+
+// ChartAssignmentNamespace customizes the namespace the ChartAssignment
+// creates for its chart. The controller keeps it in sync with the spec.
+type ChartAssignmentNamespace struct {
+	// Labels and Annotations are set on the namespace, e.g. to configure
+	// Pod Security levels or sidecar injection.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ResourceQuota and LimitRange are created in the namespace with the
+	// name of the ChartAssignment before the chart is installed.
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+	LimitRange    *corev1.LimitRangeSpec    `json:"limitRange,omitempty"`
+}
+
+// ImagePullRegistry references the credentials for a container registry.
+type ImagePullRegistry struct {
+	// Host of the registry, e.g. "eu.gcr.io" or "registry.example.com:5000".
+	Host string `json:"host"`
+	// SecretName is the name of a docker registry Secret in the "default"
+	// namespace holding credentials for the host. It is copied into the
+	// ChartAssignment's namespace. Defaults to the gcr.io pull secret.
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ChartAssignmentRollback enables automatic rollback of updates that do not
+// become ready in time.
+type ChartAssignmentRollback struct {
+	// DeadlineSeconds is the time a new generation has to become Ready before
+	// the last Ready generation is re-applied. Defaults to 10 minutes.
+	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
 }
 
 type AssignedChart struct {
-	Repository string       `json:"repository,omitempty"`
-	Name       string       `json:"name,omitempty"`
-	Version    string       `json:"version,omitempty"`
-	Inline     string       `json:"inline,omitempty"`
-	Values     ConfigValues `json:"values,omitempty"`
+	Repository string             `json:"repository,omitempty"`
+	Name       string             `json:"name,omitempty"`
+	Version    string             `json:"version,omitempty"`
+	Inline     string             `json:"inline,omitempty"`
+	Values     ConfigValues       `json:"values,omitempty"`
+	ValuesFrom []ValuesFromSource `json:"valuesFrom,omitempty"`
 }
 
+// ValuesFromSource references chart values stored in a Secret or ConfigMap
+// in the cluster the chart is installed in.
+type ValuesFromSource struct {
+	Kind ValuesFromSourceKind `json:"kind"`
+	Name string               `json:"name"`
+	// Namespace of the object. Defaults to the namespace of the chart.
+	Namespace string `json:"namespace,omitempty"`
+	// ValuesKey is the key in the object's data that holds the values.
+	// Defaults to "values.yaml".
+	ValuesKey string `json:"valuesKey,omitempty"`
+	// TargetPath is a dot-separated path at which the data is inserted as
+	// a string. If it is empty, the data is parsed as a YAML values file.
+	TargetPath string `json:"targetPath,omitempty"`
+	// Optional sources are skipped if the object or key does not exist.
+	Optional bool `json:"optional,omitempty"`
+}
+
+type ValuesFromSourceKind string
+
+const (
+	ValuesFromSourceSecret    ValuesFromSourceKind = "Secret"
+	ValuesFromSourceConfigMap ValuesFromSourceKind = "ConfigMap"
+)
+
 type ConfigValues map[string]interface{}
 
 // DeepCopy is an explicit override since the deepcopy generator cannot
@@ -246,9 +641,83 @@ func (in ConfigValues) DeepCopy() ConfigValues {
 }
 
 type ChartAssignmentStatus struct {
-	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
-	Phase              ChartAssignmentPhase       `json:"phase,omitempty"`
-	Conditions         []ChartAssignmentCondition `json:"conditions,omitempty"`
+	ObservedGeneration int64                          `json:"observedGeneration,omitempty"`
+	Phase              ChartAssignmentPhase           `json:"phase,omitempty"`
+	Conditions         []ChartAssignmentCondition     `json:"conditions,omitempty"`
+	Rollback           *ChartAssignmentRollbackStatus `json:"rollback,omitempty"`
+	// LastReady is the last generation that reached the Ready phase. It is
+	// only recorded if rollback is enabled.
+	LastReady *ChartAssignmentLastReady `json:"lastReady,omitempty"`
+	// Failure describes why the last update of the chart failed.
+	Failure *ChartAssignmentFailure `json:"failure,omitempty"`
+	// Manifests references the manifests that were last applied.
+	Manifests *ChartAssignmentManifests `json:"manifests,omitempty"`
+}
+
+// ChartAssignmentManifests references a Secret in the ChartAssignment's
+// namespace that holds the gzipped manifests applied for a generation.
+type ChartAssignmentManifests struct {
+	Generation int64  `json:"generation"`
+	SecretName string `json:"secretName"`
+}
+
+// ChartAssignmentFailure describes at which stage an update of the chart
+// failed and why.
+type ChartAssignmentFailure struct {
+	Stage   ChartAssignmentStage `json:"stage"`
+	Message string               `json:"message"`
+	// Template and Line locate the error within the chart's templates,
+	// if known.
+	Template string `json:"template,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	// Resources lists the resources that failed to apply.
+	Resources []ChartAssignmentFailedResource `json:"resources,omitempty"`
+}
+
+type ChartAssignmentFailedResource struct {
+	Group     string `json:"group,omitempty"` // Is empty for core APIs.
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ChartAssignmentStage string
+
+const (
+	// Fetch is the stage of downloading the chart from its repository.
+	ChartAssignmentStageFetch ChartAssignmentStage = "Fetch"
+	// Load is the stage of loading the chart archive and its values.
+	ChartAssignmentStageLoad ChartAssignmentStage = "Load"
+	// Dependencies is the stage of checking the chart's requirements.
+	ChartAssignmentStageDependencies ChartAssignmentStage = "Dependencies"
+	// Validate is the stage of validating the values against the chart's
+	// values.schema.json. Only charts with apiVersion v2 have a schema.
+	ChartAssignmentStageValidate ChartAssignmentStage = "Validate"
+	// Render is the stage of expanding the chart's templates.
+	ChartAssignmentStageRender ChartAssignmentStage = "Render"
+	// Decode is the stage of decoding the rendered manifests.
+	ChartAssignmentStageDecode ChartAssignmentStage = "Decode"
+	// Apply is the stage of applying the resources to the cluster.
+	ChartAssignmentStageApply ChartAssignmentStage = "Apply"
+)
+
+// ChartAssignmentRollbackStatus is set while the observed generation is
+// rolled back to the last generation that reached the Ready phase.
+type ChartAssignmentRollbackStatus struct {
+	FailedGeneration   int64       `json:"failedGeneration"`
+	RestoredGeneration int64       `json:"restoredGeneration"`
+	Time               metav1.Time `json:"time,omitempty"`
+	Reason             string      `json:"reason,omitempty"`
+}
+
+// ChartAssignmentLastReady records a generation of a ChartAssignment that
+// reached the Ready phase, so that a failed update can be rolled back to it
+// even after the controller restarted.
+type ChartAssignmentLastReady struct {
+	Generation int64               `json:"generation"`
+	Spec       ChartAssignmentSpec `json:"spec"`
 }
 
 type ChartAssignmentPhase string
@@ -277,6 +746,12 @@ const (
 	// Ready status is set when all pods are running.
 	// TODO(ensonic): check other resource readyness too?
 	ChartAssignmentPhaseReady ChartAssignmentPhase = "Ready"
+	// Paused is set while the ChartAssignment is paused and the chart is not
+	// applied.
+	ChartAssignmentPhasePaused ChartAssignmentPhase = "Paused"
+	// WaitingForDependencies is set while the ChartAssignments listed in
+	// spec.dependsOn are not Ready and the chart is not applied.
+	ChartAssignmentPhaseWaitingForDependencies ChartAssignmentPhase = "WaitingForDependencies"
 )
 
 type ChartAssignmentCondition struct {
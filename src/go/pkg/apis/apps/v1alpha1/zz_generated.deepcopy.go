@@ -19,8 +19,10 @@
 package v1alpha1
 
 import (
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -28,7 +30,7 @@ func (in *App) DeepCopyInto(out *App) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	return
 }
 
@@ -50,6 +52,214 @@ func (in *App) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundle) DeepCopyInto(out *AppBundle) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundle.
+func (in *AppBundle) DeepCopy() *AppBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AppBundle) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleApp) DeepCopyInto(out *AppBundleApp) {
+	*out = *in
+	in.Cloud.DeepCopyInto(&out.Cloud)
+	out.RobotValues = in.RobotValues.DeepCopy()
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleApp.
+func (in *AppBundleApp) DeepCopy() *AppBundleApp {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleApp)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleAppStatus) DeepCopyInto(out *AppBundleAppStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleAppStatus.
+func (in *AppBundleAppStatus) DeepCopy() *AppBundleAppStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleAppStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleCondition) DeepCopyInto(out *AppBundleCondition) {
+	*out = *in
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleCondition.
+func (in *AppBundleCondition) DeepCopy() *AppBundleCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleList) DeepCopyInto(out *AppBundleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AppBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleList.
+func (in *AppBundleList) DeepCopy() *AppBundleList {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AppBundleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleSpec) DeepCopyInto(out *AppBundleSpec) {
+	*out = *in
+	if in.Apps != nil {
+		in, out := &in.Apps, &out.Apps
+		*out = make([]AppBundleApp, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Robots != nil {
+		in, out := &in.Robots, &out.Robots
+		*out = make([]AppRolloutSpecRobot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(AppRolloutSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Strategy != nil {
+		in, out := &in.Strategy, &out.Strategy
+		*out = new(AppRolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(AppRolloutFailurePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleSpec.
+func (in *AppBundleSpec) DeepCopy() *AppBundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppBundleStatus) DeepCopyInto(out *AppBundleStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]AppBundleCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Apps != nil {
+		in, out := &in.Apps, &out.Apps
+		*out = make([]AppBundleAppStatus, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppBundleStatus.
+func (in *AppBundleStatus) DeepCopy() *AppBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AppBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppChannel) DeepCopyInto(out *AppChannel) {
+	*out = *in
+	out.Components = in.Components
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppChannel.
+func (in *AppChannel) DeepCopy() *AppChannel {
+	if in == nil {
+		return nil
+	}
+	out := new(AppChannel)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppComponent) DeepCopyInto(out *AppComponent) {
 	*out = *in
@@ -163,6 +373,66 @@ func (in *AppRolloutCondition) DeepCopy() *AppRolloutCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutDeletedRobot) DeepCopyInto(out *AppRolloutDeletedRobot) {
+	*out = *in
+	in.DeletionTime.DeepCopyInto(&out.DeletionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutDeletedRobot.
+func (in *AppRolloutDeletedRobot) DeepCopy() *AppRolloutDeletedRobot {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutDeletedRobot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutFailurePolicy) DeepCopyInto(out *AppRolloutFailurePolicy) {
+	*out = *in
+	if in.MaxFailed != nil {
+		in, out := &in.MaxFailed, &out.MaxFailed
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutFailurePolicy.
+func (in *AppRolloutFailurePolicy) DeepCopy() *AppRolloutFailurePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutFailurePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutLastReady) DeepCopyInto(out *AppRolloutLastReady) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]AppChannel, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutLastReady.
+func (in *AppRolloutLastReady) DeepCopy() *AppRolloutLastReady {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutLastReady)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppRolloutList) DeepCopyInto(out *AppRolloutList) {
 	*out = *in
@@ -196,6 +466,61 @@ func (in *AppRolloutList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutProgress) DeepCopyInto(out *AppRolloutProgress) {
+	*out = *in
+	if in.Robots != nil {
+		in, out := &in.Robots, &out.Robots
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.BatchStartTime.DeepCopyInto(&out.BatchStartTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutProgress.
+func (in *AppRolloutProgress) DeepCopy() *AppRolloutProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutRobotStatus) DeepCopyInto(out *AppRolloutRobotStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutRobotStatus.
+func (in *AppRolloutRobotStatus) DeepCopy() *AppRolloutRobotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutRobotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutSchedule) DeepCopyInto(out *AppRolloutSchedule) {
+	*out = *in
+	in.ActivationTime.DeepCopyInto(&out.ActivationTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutSchedule.
+func (in *AppRolloutSchedule) DeepCopy() *AppRolloutSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppRolloutSpec) DeepCopyInto(out *AppRolloutSpec) {
 	*out = *in
@@ -207,6 +532,26 @@ func (in *AppRolloutSpec) DeepCopyInto(out *AppRolloutSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(AppRolloutSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Strategy != nil {
+		in, out := &in.Strategy, &out.Strategy
+		*out = new(AppRolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(AppRolloutFailurePolicy)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -224,6 +569,26 @@ func (in *AppRolloutSpec) DeepCopy() *AppRolloutSpec {
 func (in *AppRolloutSpecCloud) DeepCopyInto(out *AppRolloutSpecCloud) {
 	*out = *in
 	out.Values = in.Values.DeepCopy()
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesFromSource, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImagePull != nil {
+		in, out := &in.ImagePull, &out.ImagePull
+		*out = new(ChartAssignmentImagePull)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(ChartAssignmentNamespace)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -246,6 +611,37 @@ func (in *AppRolloutSpecRobot) DeepCopyInto(out *AppRolloutSpecRobot) {
 		(*in).DeepCopyInto(*out)
 	}
 	out.Values = in.Values.DeepCopy()
+	out.ValuesTemplate = in.ValuesTemplate.DeepCopy()
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesFromSource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(ChartAssignmentRollback)
+		**out = **in
+	}
+	if in.ImagePull != nil {
+		in, out := &in.ImagePull, &out.ImagePull
+		*out = new(ChartAssignmentImagePull)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(ChartAssignmentNamespace)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UpdatePolicy != nil {
+		in, out := &in.UpdatePolicy, &out.UpdatePolicy
+		*out = new(RobotUpdatePolicy)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -269,6 +665,38 @@ func (in *AppRolloutStatus) DeepCopyInto(out *AppRolloutStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(AppRolloutProgress)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastReady != nil {
+		in, out := &in.LastReady, &out.LastReady
+		*out = new(AppRolloutLastReady)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletedRobots != nil {
+		in, out := &in.DeletedRobots, &out.DeletedRobots
+		*out = make([]AppRolloutDeletedRobot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.WaitingRobots != nil {
+		in, out := &in.WaitingRobots, &out.WaitingRobots
+		*out = make([]AppRolloutWaitingRobot, len(*in))
+		copy(*out, *in)
+	}
+	if in.Robots != nil {
+		in, out := &in.Robots, &out.Robots
+		*out = make([]AppRolloutRobotStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnreadyClusters != nil {
+		in, out := &in.UnreadyClusters, &out.UnreadyClusters
+		*out = make([]AppRolloutUnreadyCluster, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -282,10 +710,73 @@ func (in *AppRolloutStatus) DeepCopy() *AppRolloutStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutStrategy) DeepCopyInto(out *AppRolloutStrategy) {
+	*out = *in
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.BatchSize != nil {
+		in, out := &in.BatchSize, &out.BatchSize
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutStrategy.
+func (in *AppRolloutStrategy) DeepCopy() *AppRolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutUnreadyCluster) DeepCopyInto(out *AppRolloutUnreadyCluster) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutUnreadyCluster.
+func (in *AppRolloutUnreadyCluster) DeepCopy() *AppRolloutUnreadyCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutUnreadyCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AppRolloutWaitingRobot) DeepCopyInto(out *AppRolloutWaitingRobot) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AppRolloutWaitingRobot.
+func (in *AppRolloutWaitingRobot) DeepCopy() *AppRolloutWaitingRobot {
+	if in == nil {
+		return nil
+	}
+	out := new(AppRolloutWaitingRobot)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AppSpec) DeepCopyInto(out *AppSpec) {
 	*out = *in
 	out.Components = in.Components
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]AppChannel, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -303,6 +794,11 @@ func (in *AppSpec) DeepCopy() *AppSpec {
 func (in *AssignedChart) DeepCopyInto(out *AssignedChart) {
 	*out = *in
 	out.Values = in.Values.DeepCopy()
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesFromSource, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -362,6 +858,81 @@ func (in *ChartAssignmentCondition) DeepCopy() *ChartAssignmentCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentFailedResource) DeepCopyInto(out *ChartAssignmentFailedResource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentFailedResource.
+func (in *ChartAssignmentFailedResource) DeepCopy() *ChartAssignmentFailedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentFailedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentFailure) DeepCopyInto(out *ChartAssignmentFailure) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]ChartAssignmentFailedResource, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentFailure.
+func (in *ChartAssignmentFailure) DeepCopy() *ChartAssignmentFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentFailure)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentImagePull) DeepCopyInto(out *ChartAssignmentImagePull) {
+	*out = *in
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = make([]ImagePullRegistry, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentImagePull.
+func (in *ChartAssignmentImagePull) DeepCopy() *ChartAssignmentImagePull {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentImagePull)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentLastReady) DeepCopyInto(out *ChartAssignmentLastReady) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentLastReady.
+func (in *ChartAssignmentLastReady) DeepCopy() *ChartAssignmentLastReady {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentLastReady)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ChartAssignmentList) DeepCopyInto(out *ChartAssignmentList) {
 	*out = *in
@@ -395,10 +966,124 @@ func (in *ChartAssignmentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentManifests) DeepCopyInto(out *ChartAssignmentManifests) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentManifests.
+func (in *ChartAssignmentManifests) DeepCopy() *ChartAssignmentManifests {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentManifests)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentNamespace) DeepCopyInto(out *ChartAssignmentNamespace) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ResourceQuota != nil {
+		in, out := &in.ResourceQuota, &out.ResourceQuota
+		*out = new(v1.ResourceQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LimitRange != nil {
+		in, out := &in.LimitRange, &out.LimitRange
+		*out = new(v1.LimitRangeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentNamespace.
+func (in *ChartAssignmentNamespace) DeepCopy() *ChartAssignmentNamespace {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentNamespace)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentRollback) DeepCopyInto(out *ChartAssignmentRollback) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentRollback.
+func (in *ChartAssignmentRollback) DeepCopy() *ChartAssignmentRollback {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentRollback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartAssignmentRollbackStatus) DeepCopyInto(out *ChartAssignmentRollbackStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartAssignmentRollbackStatus.
+func (in *ChartAssignmentRollbackStatus) DeepCopy() *ChartAssignmentRollbackStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartAssignmentRollbackStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ChartAssignmentSpec) DeepCopyInto(out *ChartAssignmentSpec) {
 	*out = *in
 	in.Chart.DeepCopyInto(&out.Chart)
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(ChartAssignmentRollback)
+		**out = **in
+	}
+	if in.ImagePull != nil {
+		in, out := &in.ImagePull, &out.ImagePull
+		*out = new(ChartAssignmentImagePull)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(ChartAssignmentNamespace)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -422,6 +1107,26 @@ func (in *ChartAssignmentStatus) DeepCopyInto(out *ChartAssignmentStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(ChartAssignmentRollbackStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastReady != nil {
+		in, out := &in.LastReady, &out.LastReady
+		*out = new(ChartAssignmentLastReady)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Failure != nil {
+		in, out := &in.Failure, &out.Failure
+		*out = new(ChartAssignmentFailure)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Manifests != nil {
+		in, out := &in.Manifests, &out.Manifests
+		*out = new(ChartAssignmentManifests)
+		**out = **in
+	}
 	return
 }
 
@@ -444,6 +1149,43 @@ func (in ConfigValues) DeepCopyInto(out *ConfigValues) {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePullRegistry) DeepCopyInto(out *ImagePullRegistry) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePullRegistry.
+func (in *ImagePullRegistry) DeepCopy() *ImagePullRegistry {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePullRegistry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceRef) DeepCopyInto(out *ResourceRef) {
 	*out = *in
@@ -639,7 +1381,7 @@ func (in *RobotSelector) DeepCopyInto(out *RobotSelector) {
 	*out = *in
 	if in.LabelSelector != nil {
 		in, out := &in.LabelSelector, &out.LabelSelector
-		*out = new(v1.LabelSelector)
+		*out = new(metav1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
 	if in.Any != nil {
@@ -659,3 +1401,42 @@ func (in *RobotSelector) DeepCopy() *RobotSelector {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RobotUpdatePolicy) DeepCopyInto(out *RobotUpdatePolicy) {
+	*out = *in
+	if in.MaintenanceWindows != nil {
+		in, out := &in.MaintenanceWindows, &out.MaintenanceWindows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RobotUpdatePolicy.
+func (in *RobotUpdatePolicy) DeepCopy() *RobotUpdatePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RobotUpdatePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesFromSource) DeepCopyInto(out *ValuesFromSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesFromSource.
+func (in *ValuesFromSource) DeepCopy() *ValuesFromSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesFromSource)
+	in.DeepCopyInto(out)
+	return out
+}
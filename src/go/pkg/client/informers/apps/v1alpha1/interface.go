@@ -24,6 +24,8 @@ import (
 type Interface interface {
 	// Apps returns a AppInformer.
 	Apps() AppInformer
+	// AppBundles returns a AppBundleInformer.
+	AppBundles() AppBundleInformer
 	// AppRollouts returns a AppRolloutInformer.
 	AppRollouts() AppRolloutInformer
 	// ChartAssignments returns a ChartAssignmentInformer.
@@ -48,6 +50,11 @@ func (v *version) Apps() AppInformer {
 	return &appInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// AppBundles returns a AppBundleInformer.
+func (v *version) AppBundles() AppBundleInformer {
+	return &appBundleInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // AppRollouts returns a AppRolloutInformer.
 func (v *version) AppRollouts() AppRolloutInformer {
 	return &appRolloutInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -54,6 +54,8 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	// Group=apps.cloudrobotics.com, Version=v1alpha1
 	case v1alpha1.SchemeGroupVersion.WithResource("apps"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha1().Apps().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("appbundles"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha1().AppBundles().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("approllouts"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Apps().V1alpha1().AppRollouts().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("chartassignments"):
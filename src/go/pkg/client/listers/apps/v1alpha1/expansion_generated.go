@@ -20,6 +20,10 @@ package v1alpha1
 // AppLister.
 type AppListerExpansion interface{}
 
+// AppBundleListerExpansion allows custom methods to be added to
+// AppBundleLister.
+type AppBundleListerExpansion interface{}
+
 // AppRolloutListerExpansion allows custom methods to be added to
 // AppRolloutLister.
 type AppRolloutListerExpansion interface{}
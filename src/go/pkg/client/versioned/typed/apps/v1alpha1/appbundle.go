@@ -0,0 +1,178 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1alpha1 "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	scheme "github.com/googlecloudrobotics/core/src/go/pkg/client/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// AppBundlesGetter has a method to return a AppBundleInterface.
+// A group's client should implement this interface.
+type AppBundlesGetter interface {
+	AppBundles() AppBundleInterface
+}
+
+// AppBundleInterface has methods to work with AppBundle resources.
+type AppBundleInterface interface {
+	Create(*v1alpha1.AppBundle) (*v1alpha1.AppBundle, error)
+	Update(*v1alpha1.AppBundle) (*v1alpha1.AppBundle, error)
+	UpdateStatus(*v1alpha1.AppBundle) (*v1alpha1.AppBundle, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.AppBundle, error)
+	List(opts v1.ListOptions) (*v1alpha1.AppBundleList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.AppBundle, err error)
+	AppBundleExpansion
+}
+
+// appBundles implements AppBundleInterface
+type appBundles struct {
+	client rest.Interface
+}
+
+// newAppBundles returns a AppBundles
+func newAppBundles(c *AppsV1alpha1Client) *appBundles {
+	return &appBundles{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the appBundle, and returns the corresponding appBundle object, and an error if there is any.
+func (c *appBundles) Get(name string, options v1.GetOptions) (result *v1alpha1.AppBundle, err error) {
+	result = &v1alpha1.AppBundle{}
+	err = c.client.Get().
+		Resource("appbundles").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of AppBundles that match those selectors.
+func (c *appBundles) List(opts v1.ListOptions) (result *v1alpha1.AppBundleList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.AppBundleList{}
+	err = c.client.Get().
+		Resource("appbundles").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested appBundles.
+func (c *appBundles) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("appbundles").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a appBundle and creates it.  Returns the server's representation of the appBundle, and an error, if there is any.
+func (c *appBundles) Create(appBundle *v1alpha1.AppBundle) (result *v1alpha1.AppBundle, err error) {
+	result = &v1alpha1.AppBundle{}
+	err = c.client.Post().
+		Resource("appbundles").
+		Body(appBundle).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a appBundle and updates it. Returns the server's representation of the appBundle, and an error, if there is any.
+func (c *appBundles) Update(appBundle *v1alpha1.AppBundle) (result *v1alpha1.AppBundle, err error) {
+	result = &v1alpha1.AppBundle{}
+	err = c.client.Put().
+		Resource("appbundles").
+		Name(appBundle.Name).
+		Body(appBundle).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *appBundles) UpdateStatus(appBundle *v1alpha1.AppBundle) (result *v1alpha1.AppBundle, err error) {
+	result = &v1alpha1.AppBundle{}
+	err = c.client.Put().
+		Resource("appbundles").
+		Name(appBundle.Name).
+		SubResource("status").
+		Body(appBundle).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the appBundle and deletes it. Returns an error if one occurs.
+func (c *appBundles) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("appbundles").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *appBundles) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("appbundles").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched appBundle.
+func (c *appBundles) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.AppBundle, err error) {
+	result = &v1alpha1.AppBundle{}
+	err = c.client.Patch(pt).
+		Resource("appbundles").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
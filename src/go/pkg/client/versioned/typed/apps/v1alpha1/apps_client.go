@@ -25,6 +25,7 @@ import (
 type AppsV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	AppsGetter
+	AppBundlesGetter
 	AppRolloutsGetter
 	ChartAssignmentsGetter
 	ResourceSetsGetter
@@ -39,6 +40,10 @@ func (c *AppsV1alpha1Client) Apps() AppInterface {
 	return newApps(c)
 }
 
+func (c *AppsV1alpha1Client) AppBundles() AppBundleInterface {
+	return newAppBundles(c)
+}
+
 func (c *AppsV1alpha1Client) AppRollouts() AppRolloutInterface {
 	return newAppRollouts(c)
 }
@@ -0,0 +1,129 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1alpha1 "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeAppBundles implements AppBundleInterface
+type FakeAppBundles struct {
+	Fake *FakeAppsV1alpha1
+}
+
+var appbundlesResource = schema.GroupVersionResource{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Resource: "appbundles"}
+
+var appbundlesKind = schema.GroupVersionKind{Group: "apps.cloudrobotics.com", Version: "v1alpha1", Kind: "AppBundle"}
+
+// Get takes name of the appBundle, and returns the corresponding appBundle object, and an error if there is any.
+func (c *FakeAppBundles) Get(name string, options v1.GetOptions) (result *v1alpha1.AppBundle, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(appbundlesResource, name), &v1alpha1.AppBundle{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.AppBundle), err
+}
+
+// List takes label and field selectors, and returns the list of AppBundles that match those selectors.
+func (c *FakeAppBundles) List(opts v1.ListOptions) (result *v1alpha1.AppBundleList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(appbundlesResource, appbundlesKind, opts), &v1alpha1.AppBundleList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.AppBundleList{ListMeta: obj.(*v1alpha1.AppBundleList).ListMeta}
+	for _, item := range obj.(*v1alpha1.AppBundleList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested appBundles.
+func (c *FakeAppBundles) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(appbundlesResource, opts))
+}
+
+// Create takes the representation of a appBundle and creates it.  Returns the server's representation of the appBundle, and an error, if there is any.
+func (c *FakeAppBundles) Create(appBundle *v1alpha1.AppBundle) (result *v1alpha1.AppBundle, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(appbundlesResource, appBundle), &v1alpha1.AppBundle{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.AppBundle), err
+}
+
+// Update takes the representation of a appBundle and updates it. Returns the server's representation of the appBundle, and an error, if there is any.
+func (c *FakeAppBundles) Update(appBundle *v1alpha1.AppBundle) (result *v1alpha1.AppBundle, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(appbundlesResource, appBundle), &v1alpha1.AppBundle{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.AppBundle), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeAppBundles) UpdateStatus(appBundle *v1alpha1.AppBundle) (*v1alpha1.AppBundle, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(appbundlesResource, "status", appBundle), &v1alpha1.AppBundle{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.AppBundle), err
+}
+
+// Delete takes name of the appBundle and deletes it. Returns an error if one occurs.
+func (c *FakeAppBundles) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(appbundlesResource, name), &v1alpha1.AppBundle{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeAppBundles) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(appbundlesResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.AppBundleList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched appBundle.
+func (c *FakeAppBundles) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.AppBundle, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(appbundlesResource, name, pt, data, subresources...), &v1alpha1.AppBundle{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.AppBundle), err
+}
@@ -30,6 +30,10 @@ func (c *FakeAppsV1alpha1) Apps() v1alpha1.AppInterface {
 	return &FakeApps{c}
 }
 
+func (c *FakeAppsV1alpha1) AppBundles() v1alpha1.AppBundleInterface {
+	return &FakeAppBundles{c}
+}
+
 func (c *FakeAppsV1alpha1) AppRollouts() v1alpha1.AppRolloutInterface {
 	return &FakeAppRollouts{c}
 }
@@ -0,0 +1,412 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/helm/pkg/chartutil"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const labelAppBundle = "cloudrobotics.com/app-bundle"
+
+// addBundleController adds a controller for the AppBundle resource type,
+// which creates an AppRollout for each app of a bundle.
+func addBundleController(mgr manager.Manager) error {
+	r := &bundleReconciler{
+		kube: mgr.GetClient(),
+	}
+	c, err := controller.New("appbundle", mgr, controller.Options{
+		Reconciler: r,
+	})
+	if err != nil {
+		return errors.Wrap(err, "create controller")
+	}
+	err = mgr.GetCache().IndexField(&apps.AppRollout{}, fieldIndexOwners, indexOwnerReferences)
+	if err != nil {
+		return errors.Wrap(err, "add field indexer")
+	}
+	err = c.Watch(
+		&source.Kind{Type: &apps.AppBundle{}},
+		&handler.EnqueueRequestForObject{},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch AppBundles")
+	}
+	// The status of a bundle aggregates the status of its AppRollouts.
+	err = c.Watch(
+		&source.Kind{Type: &apps.AppRollout{}},
+		&handler.Funcs{
+			DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+				enqueueForBundle(e.Meta, q)
+			},
+			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+				enqueueForBundle(e.MetaNew, q)
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch AppRollouts")
+	}
+	return nil
+}
+
+func enqueueForBundle(m metav1.Object, q workqueue.RateLimitingInterface) {
+	for _, or := range m.GetOwnerReferences() {
+		if or.APIVersion == apps.SchemeGroupVersion.String() && or.Kind == "AppBundle" {
+			q.Add(reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: or.Name},
+			})
+		}
+	}
+}
+
+// bundleReconciler creates, updates and deletes the AppRollouts of
+// AppBundles.
+type bundleReconciler struct {
+	kube kclient.Client
+}
+
+func (r *bundleReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
+	ctx := context.TODO()
+
+	var b apps.AppBundle
+	err := r.kube.Get(ctx, req.NamespacedName, &b)
+
+	if k8serrors.IsNotFound(err) {
+		// AppBundle was already deleted, its AppRollouts are garbage
+		// collected.
+		return reconcile.Result{}, nil
+	} else if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "get AppBundle %q", req)
+	}
+	return r.reconcile(ctx, &b)
+}
+
+func (r *bundleReconciler) reconcile(ctx context.Context, b *apps.AppBundle) (reconcile.Result, error) {
+	log.Printf("Reconcile AppBundle %q (version: %s)", b.Name, b.ResourceVersion)
+
+	b.Status.ObservedGeneration = b.Generation
+
+	if err := validateBundle(b); err != nil {
+		setBundleCondition(b, apps.AppBundleConditionSettled, core.ConditionFalse, err.Error())
+		return reconcile.Result{}, r.updateStatus(ctx, b)
+	}
+	var curARs apps.AppRolloutList
+	err := r.kube.List(ctx, &curARs, kclient.MatchingField(fieldIndexOwners, string(b.UID)))
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "list AppRollouts for owner UID %s", b.UID)
+	}
+	// AppRollouts that are no longer wanted. We pre-populate it with all
+	// existing ones and remove those that we want to keep.
+	dropARs := map[string]apps.AppRollout{}
+	for _, ar := range curARs.Items {
+		dropARs[ar.Name] = ar
+	}
+	var (
+		// Current AppRollouts by app name. Those that were just created
+		// or updated have no matching status yet.
+		rollouts = map[string]*apps.AppRollout{}
+		failures []string
+	)
+	for i := range b.Spec.Apps {
+		app := &b.Spec.Apps[i]
+		ar := newBundleRollout(b, app)
+
+		prev, exists := dropARs[ar.Name]
+		delete(dropARs, ar.Name)
+
+		if !exists {
+			if err := r.kube.Create(ctx, ar); err != nil {
+				failures = append(failures, fmt.Sprintf("create AppRollout %q: %s", ar.Name, err))
+				continue
+			}
+			log.Printf("Created AppRollout %q", ar.Name)
+			rollouts[app.Name] = ar
+			continue
+		}
+		if reflect.DeepEqual(prev.Spec, ar.Spec) && reflect.DeepEqual(prev.Labels, ar.Labels) {
+			rollouts[app.Name] = &prev
+			continue
+		}
+		prev.Labels = ar.Labels
+		prev.Spec = ar.Spec
+		if err := r.kube.Update(ctx, &prev); err != nil {
+			failures = append(failures, fmt.Sprintf("update AppRollout %q: %s", ar.Name, err))
+			continue
+		}
+		log.Printf("Updated AppRollout %q", ar.Name)
+		rollouts[app.Name] = &prev
+	}
+	for _, ar := range dropARs {
+		if err := r.kube.Delete(ctx, &ar); err != nil {
+			return reconcile.Result{}, errors.Wrapf(err, "delete AppRollout %q", ar.Name)
+		}
+		log.Printf("Deleted AppRollout %q", ar.Name)
+	}
+	setBundleStatus(b, rollouts)
+
+	if len(failures) > 0 {
+		setBundleCondition(b, apps.AppBundleConditionSettled, core.ConditionFalse, strings.Join(failures, "; "))
+		if err := r.updateStatus(ctx, b); err != nil {
+			return reconcile.Result{}, err
+		}
+		// Retry with backoff, e.g. once a conflicting AppRollout is gone.
+		return reconcile.Result{}, errors.Errorf("apply AppRollouts of AppBundle %q failed", b.Name)
+	}
+	setBundleCondition(b, apps.AppBundleConditionSettled, core.ConditionTrue, "")
+	return reconcile.Result{}, r.updateStatus(ctx, b)
+}
+
+func (r *bundleReconciler) updateStatus(ctx context.Context, b *apps.AppBundle) error {
+	if err := r.kube.Status().Update(ctx, b); err != nil {
+		return errors.Wrap(err, "update status")
+	}
+	return nil
+}
+
+// setBundleStatus sets the status of the bundle from the current AppRollouts
+// of its apps.
+func setBundleStatus(b *apps.AppBundle, rollouts map[string]*apps.AppRollout) {
+	b.Status.Apps = nil
+	ready := 0
+
+	for _, app := range b.Spec.Apps {
+		s := apps.AppBundleAppStatus{
+			Name:    app.Name,
+			Rollout: bundleRolloutName(b.Name, app.Name),
+		}
+		if ar, ok := rollouts[app.Name]; ok {
+			s.Assignments = ar.Status.Assignments
+			s.ReadyAssignments = ar.Status.ReadyAssignments
+			s.FailedAssignments = ar.Status.FailedAssignments
+			s.Summary = ar.Status.Summary
+			s.Ready = ar.Generation != 0 && ar.Status.ObservedGeneration == ar.Generation &&
+				ar.Status.ReadyAssignments == ar.Status.Assignments
+		}
+		if s.Ready {
+			ready++
+		}
+		b.Status.Apps = append(b.Status.Apps, s)
+	}
+	b.Status.Summary = fmt.Sprintf("%d/%d apps ready", ready, len(b.Spec.Apps))
+
+	if ready == len(b.Spec.Apps) {
+		setBundleCondition(b, apps.AppBundleConditionReady, core.ConditionTrue, "")
+	} else {
+		setBundleCondition(b, apps.AppBundleConditionReady, core.ConditionFalse, b.Status.Summary)
+	}
+}
+
+func setBundleCondition(b *apps.AppBundle, t apps.AppBundleConditionType, s core.ConditionStatus, msg string) {
+	now := metav1.Now()
+
+	for i, c := range b.Status.Conditions {
+		if c.Type != t {
+			continue
+		}
+		// Update existing condition.
+		if c.Status != s || c.Message != msg {
+			c.LastUpdateTime = now
+		}
+		if c.Status != s {
+			c.LastTransitionTime = now
+		}
+		c.Message = msg
+		c.Status = s
+		b.Status.Conditions[i] = c
+		return
+	}
+	// Condition set for the first time.
+	b.Status.Conditions = append(b.Status.Conditions, apps.AppBundleCondition{
+		Type:               t,
+		LastUpdateTime:     now,
+		LastTransitionTime: now,
+		Status:             s,
+		Message:            msg,
+	})
+}
+
+func bundleRolloutName(bundle, app string) string {
+	return fmt.Sprintf("%s-%s", bundle, app)
+}
+
+// newBundleRollout generates the AppRollout for an app of the bundle.
+func newBundleRollout(b *apps.AppBundle, app *apps.AppBundleApp) *apps.AppRollout {
+	_true := true
+	ar := &apps.AppRollout{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apps.SchemeGroupVersion.String(),
+			Kind:       "AppRollout",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: bundleRolloutName(b.Name, app.Name),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         apps.SchemeGroupVersion.String(),
+				Kind:               "AppBundle",
+				Name:               b.Name,
+				UID:                b.UID,
+				BlockOwnerDeletion: &_true,
+				Controller:         &_true,
+			}},
+		},
+		Spec: apps.AppRolloutSpec{
+			AppName:         app.AppName,
+			Cloud:           *app.Cloud.DeepCopy(),
+			Paused:          b.Spec.Paused,
+			Schedule:        b.Spec.Schedule.DeepCopy(),
+			Strategy:        b.Spec.Strategy.DeepCopy(),
+			FailurePolicy:   b.Spec.FailurePolicy.DeepCopy(),
+			SelectorOverlap: b.Spec.SelectorOverlap,
+		},
+	}
+	for k, v := range b.Labels {
+		setLabel(&ar.ObjectMeta, k, v)
+	}
+	setLabel(&ar.ObjectMeta, labelAppBundle, b.Name)
+
+	for _, dep := range app.DependsOn {
+		ar.Spec.DependsOn = append(ar.Spec.DependsOn, bundleRolloutName(b.Name, dep))
+	}
+	for _, r := range b.Spec.Robots {
+		rs := *r.DeepCopy()
+		// The values of a robot entry take precedence over the ones of
+		// the app, like they do over the base values of a rollout.
+		if len(app.RobotValues) > 0 {
+			vals := chartutil.Values{}
+			vals.MergeInto(chartutil.Values(app.RobotValues.DeepCopy()))
+			vals.MergeInto(chartutil.Values(rs.Values))
+			rs.Values = apps.ConfigValues(vals)
+		}
+		ar.Spec.Robots = append(ar.Spec.Robots, rs)
+	}
+	return ar
+}
+
+// validateBundle checks the apps of the bundle and the AppRollouts generated
+// for them.
+func validateBundle(b *apps.AppBundle) error {
+	names := map[string]bool{}
+	for i, app := range b.Spec.Apps {
+		if errs := validation.IsDNS1123Label(app.Name); len(errs) > 0 {
+			return errors.Errorf(".spec.apps[%d].name: %s", i, strings.Join(errs, ", "))
+		}
+		if names[app.Name] {
+			return errors.Errorf(".spec.apps[%d].name: duplicate app %q", i, app.Name)
+		}
+		names[app.Name] = true
+	}
+	for i := range b.Spec.Apps {
+		app := &b.Spec.Apps[i]
+		for _, dep := range app.DependsOn {
+			if !names[dep] {
+				return errors.Errorf(".spec.apps[%d].dependsOn: unknown app %q", i, dep)
+			}
+		}
+		if err := validate(newBundleRollout(b, app)); err != nil {
+			return errors.Wrapf(err, "AppRollout for .spec.apps[%d]", i)
+		}
+	}
+	if cycle := bundleDependencyCycle(b); cycle != nil {
+		return errors.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// bundleDependencyCycle returns the names of apps of the bundle that form a
+// cycle through their dependencies, or nil if there is none.
+func bundleDependencyCycle(b *apps.AppBundle) []string {
+	deps := map[string][]string{}
+	for _, app := range b.Spec.Apps {
+		deps[app.Name] = app.DependsOn
+	}
+	done := map[string]bool{}
+
+	var visit func(path []string) []string
+	visit = func(path []string) []string {
+		cur := path[len(path)-1]
+		if done[cur] {
+			return nil
+		}
+		for _, dep := range deps[cur] {
+			for i, p := range path {
+				if p == dep {
+					return append(append([]string(nil), path[i:]...), dep)
+				}
+			}
+			if cycle := visit(append(path, dep)); cycle != nil {
+				return cycle
+			}
+		}
+		done[cur] = true
+		return nil
+	}
+	for _, app := range b.Spec.Apps {
+		if cycle := visit([]string{app.Name}); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// NewBundleValidationWebhook returns a new webhook that validates AppBundles.
+func NewBundleValidationWebhook(mgr manager.Manager) *admission.Webhook {
+	return &admission.Webhook{Handler: newAppBundleValidator(mgr.GetScheme())}
+}
+
+// appBundleValidator implements a validation webhook.
+type appBundleValidator struct {
+	decoder runtime.Decoder
+}
+
+func newAppBundleValidator(sc *runtime.Scheme) *appBundleValidator {
+	return &appBundleValidator{
+		decoder: newAppRolloutValidator(sc).decoder,
+	}
+}
+
+func (v *appBundleValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	cur := &apps.AppBundle{}
+
+	if err := runtime.DecodeInto(v.decoder, req.AdmissionRequest.Object.Raw, cur); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := validateBundle(cur); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testBundle = `
+metadata:
+  name: fleet
+  uid: bundle-uid
+  labels:
+    team: nav
+spec:
+  strategy:
+    batchSize: 50%
+  robots:
+  - selector:
+      any: true
+    values:
+      site: hq
+  - selector:
+      matchLabels:
+        site: lab
+    priority: 1
+  apps:
+  - name: navigation
+    appName: navigation-v2
+    robotValues:
+      site: unknown
+      maxSpeed: 2
+  - name: ui
+    appName: ui-v7
+    cloud:
+      values:
+        replicas: 2
+    dependsOn: [navigation]
+`
+
+func TestNewBundleRollout(t *testing.T) {
+	var b apps.AppBundle
+	unmarshalYAML(t, &b, testBundle)
+
+	var want apps.AppRollout
+	unmarshalYAML(t, &want, `
+apiVersion: apps.cloudrobotics.com/v1alpha1
+kind: AppRollout
+metadata:
+  name: fleet-navigation
+  labels:
+    team: nav
+    cloudrobotics.com/app-bundle: fleet
+  ownerReferences:
+  - apiVersion: apps.cloudrobotics.com/v1alpha1
+    kind: AppBundle
+    name: fleet
+    uid: bundle-uid
+    blockOwnerDeletion: true
+    controller: true
+spec:
+  appName: navigation-v2
+  strategy:
+    batchSize: 50%
+  robots:
+  - selector:
+      any: true
+    values:
+      site: hq
+      maxSpeed: 2
+  - selector:
+      matchLabels:
+        site: lab
+    priority: 1
+    values:
+      site: unknown
+      maxSpeed: 2
+`)
+	got := newBundleRollout(&b, &b.Spec.Apps[0])
+	if wantStr, gotStr := marshalYAML(t, &want), marshalYAML(t, got); wantStr != gotStr {
+		t.Errorf("Expected AppRollout:\n%s\ngot:\n%s", wantStr, gotStr)
+	}
+
+	got = newBundleRollout(&b, &b.Spec.Apps[1])
+	if got.Name != "fleet-ui" || got.Spec.AppName != "ui-v7" {
+		t.Errorf("Unexpected AppRollout %q for App %q", got.Name, got.Spec.AppName)
+	}
+	if want := []string{"fleet-navigation"}; !reflect.DeepEqual(got.Spec.DependsOn, want) {
+		t.Errorf("Expected dependencies %v but got %v", want, got.Spec.DependsOn)
+	}
+	if got.Spec.Cloud.Values["replicas"] != float64(2) {
+		t.Errorf("Expected cloud values to be passed but got %v", got.Spec.Cloud.Values)
+	}
+}
+
+func TestValidateBundle(t *testing.T) {
+	var valid apps.AppBundle
+	unmarshalYAML(t, &valid, testBundle)
+	if err := validateBundle(&valid); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		name   string
+		modify func(b *apps.AppBundle)
+		err    string
+	}{
+		{
+			name:   "invalid-name",
+			modify: func(b *apps.AppBundle) { b.Spec.Apps[0].Name = "Navigation" },
+			err:    ".spec.apps[0].name",
+		},
+		{
+			name:   "duplicate-name",
+			modify: func(b *apps.AppBundle) { b.Spec.Apps[1].Name = "navigation" },
+			err:    "duplicate app",
+		},
+		{
+			name:   "missing-app-name",
+			modify: func(b *apps.AppBundle) { b.Spec.Apps[1].AppName = "" },
+			err:    "app name missing",
+		},
+		{
+			name:   "unknown-dependency",
+			modify: func(b *apps.AppBundle) { b.Spec.Apps[1].DependsOn = []string{"telemetry"} },
+			err:    `unknown app "telemetry"`,
+		},
+		{
+			name:   "cycle",
+			modify: func(b *apps.AppBundle) { b.Spec.Apps[0].DependsOn = []string{"ui"} },
+			err:    "dependency cycle: navigation -> ui -> navigation",
+		},
+		{
+			name:   "invalid-robots",
+			modify: func(b *apps.AppBundle) { b.Spec.Robots[1].Selector = nil },
+			err:    "no selector provided",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := valid.DeepCopy()
+			c.modify(b)
+			err := validateBundle(b)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("Expected error containing %q but got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestSetBundleStatus(t *testing.T) {
+	var b apps.AppBundle
+	unmarshalYAML(t, &b, testBundle)
+
+	var nav apps.AppRollout
+	unmarshalYAML(t, &nav, `
+metadata:
+  name: fleet-navigation
+  generation: 2
+status:
+  observedGeneration: 2
+  assignments: 3
+  readyAssignments: 3
+  summary: 3/3 ready
+`)
+	setBundleStatus(&b, map[string]*apps.AppRollout{"navigation": &nav})
+
+	want := []apps.AppBundleAppStatus{
+		{Name: "navigation", Rollout: "fleet-navigation", Assignments: 3, ReadyAssignments: 3, Ready: true, Summary: "3/3 ready"},
+		{Name: "ui", Rollout: "fleet-ui"},
+	}
+	if !reflect.DeepEqual(b.Status.Apps, want) {
+		t.Errorf("Expected apps status %+v but got %+v", want, b.Status.Apps)
+	}
+	if want := "1/2 apps ready"; b.Status.Summary != want {
+		t.Errorf("Expected summary %q but got %q", want, b.Status.Summary)
+	}
+	if c := b.Status.Conditions[0]; c.Type != apps.AppBundleConditionReady || c.Status != "False" {
+		t.Errorf("Unexpected condition %+v, expected Ready=False", c)
+	}
+}
+
+// bundleCondition returns the condition of the given type or nil.
+func bundleCondition(conds []apps.AppBundleCondition, t apps.AppBundleConditionType) *apps.AppBundleCondition {
+	for i := range conds {
+		if conds[i].Type == t {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// failingCreateClient fails to create any object.
+type failingCreateClient struct {
+	kclient.Client
+}
+
+func (c failingCreateClient) Create(ctx context.Context, obj runtime.Object, opts ...kclient.CreateOption) error {
+	return errors.New("forbidden")
+}
+
+func TestBundleReconcile(t *testing.T) {
+	var b apps.AppBundle
+	unmarshalYAML(t, &b, testBundle)
+
+	// The AppRollout of the ui app is outdated and the one of the map app
+	// was removed from the bundle.
+	ui := newBundleRollout(&b, &apps.AppBundleApp{Name: "ui", AppName: "ui-v6"})
+	old := newBundleRollout(&b, &apps.AppBundleApp{Name: "map", AppName: "map-v1"})
+	kube := newFakeClient(t, &b, ui, old)
+	r := &bundleReconciler{kube: kube}
+
+	if _, err := r.reconcile(context.Background(), &b); err != nil {
+		t.Fatalf("reconcile failed: %s", err)
+	}
+
+	var ars apps.AppRolloutList
+	if err := kube.List(context.Background(), &ars); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ar := range ars.Items {
+		names = append(names, ar.Name)
+		want := newBundleRollout(&b, &b.Spec.Apps[0])
+		if ar.Name == "fleet-ui" {
+			want = newBundleRollout(&b, &b.Spec.Apps[1])
+		}
+		if got, want := marshalYAML(t, ar.Spec), marshalYAML(t, want.Spec); got != want {
+			t.Errorf("AppRollout %q: expected spec\n%s\nbut got\n%s", ar.Name, want, got)
+		}
+	}
+	sort.Strings(names)
+	if want := []string{"fleet-navigation", "fleet-ui"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected AppRollouts %v but got %v", want, names)
+	}
+
+	var got apps.AppBundle
+	if err := kube.Get(context.Background(), kclient.ObjectKey{Name: b.Name}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if c := bundleCondition(got.Status.Conditions, apps.AppBundleConditionSettled); c == nil || c.Status != core.ConditionTrue {
+		t.Errorf("Expected Settled=True condition but got %+v", c)
+	}
+	if want := "0/2 apps ready"; got.Status.Summary != want {
+		t.Errorf("Expected summary %q but got %q", want, got.Status.Summary)
+	}
+}
+
+func TestBundleReconcile_reportsFailures(t *testing.T) {
+	var b apps.AppBundle
+	unmarshalYAML(t, &b, testBundle)
+
+	kube := newFakeClient(t, &b)
+	r := &bundleReconciler{kube: failingCreateClient{kube}}
+
+	if _, err := r.reconcile(context.Background(), &b); err == nil {
+		t.Fatal("expected reconcile to fail")
+	}
+
+	var got apps.AppBundle
+	if err := kube.Get(context.Background(), kclient.ObjectKey{Name: b.Name}, &got); err != nil {
+		t.Fatal(err)
+	}
+	c := bundleCondition(got.Status.Conditions, apps.AppBundleConditionSettled)
+	if c == nil || c.Status != core.ConditionFalse {
+		t.Fatalf("Expected Settled=False condition but got %+v", c)
+	}
+	if want := `create AppRollout "fleet-navigation": forbidden`; !strings.Contains(c.Message, want) {
+		t.Errorf("Expected condition message to contain %q but got %q", want, c.Message)
+	}
+}
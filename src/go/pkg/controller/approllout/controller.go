@@ -17,6 +17,7 @@ package approllout
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -27,6 +28,7 @@ import (
 
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
 	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/googlecloudrobotics/core/src/go/pkg/controller/chartassignment"
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
@@ -36,6 +38,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/helm/pkg/chartutil"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -50,17 +53,45 @@ import (
 )
 
 const (
-	fieldIndexOwners  = "metadata.ownerReferences.uid"
-	fieldIndexAppName = "spec.appName"
-	labelRobotName    = "cloudrobotics.com/robot-name"
+	fieldIndexOwners    = "metadata.ownerReferences.uid"
+	fieldIndexAppName   = "spec.appName"
+	fieldIndexDependsOn = "spec.dependsOn"
+	labelRobotName      = "cloudrobotics.com/robot-name"
+
+	// maxUnreadyClusters bounds the number of clusters that are listed in
+	// the status.
+	maxUnreadyClusters = 20
+	// DefaultRobotDeletionGracePeriod is how long the ChartAssignments of a
+	// deleted robot are kept by default.
+	DefaultRobotDeletionGracePeriod = time.Minute
+
+	// maxWaitingRobots bounds the number of robots waiting for their update
+	// policy that are listed in the status.
+	maxWaitingRobots = 20
+	// maxOverlappingRobots bounds the number of robots matching several
+	// entries of spec.robots that are listed in the status.
+	maxOverlappingRobots = 20
 )
 
+// Options configures the AppRollout controller.
+type Options struct {
+	// RobotDeletionGracePeriod is how long the ChartAssignments of a
+	// deleted robot are kept in case it reappears. Defaults to
+	// DefaultRobotDeletionGracePeriod, negative values delete them right
+	// away.
+	RobotDeletionGracePeriod time.Duration
+}
+
 // Add adds a controller for the AppRollout resource type
 // to the manager and server.
-func Add(mgr manager.Manager, baseValues chartutil.Values) error {
+func Add(mgr manager.Manager, baseValues chartutil.Values, opts Options) error {
 	r := &Reconciler{
-		kube:       mgr.GetClient(),
-		baseValues: baseValues,
+		kube:                     mgr.GetClient(),
+		baseValues:               baseValues,
+		robotDeletionGracePeriod: opts.RobotDeletionGracePeriod,
+	}
+	if r.robotDeletionGracePeriod == 0 {
+		r.robotDeletionGracePeriod = DefaultRobotDeletionGracePeriod
 	}
 	c, err := controller.New("approllout", mgr, controller.Options{
 		Reconciler: r,
@@ -77,6 +108,14 @@ func Add(mgr manager.Manager, baseValues chartutil.Values) error {
 	if err != nil {
 		return errors.Wrap(err, "add field indexer")
 	}
+	err = mgr.GetCache().IndexField(&apps.AppRollout{}, fieldIndexDependsOn, indexDependsOn)
+	if err != nil {
+		return errors.Wrap(err, "add field indexer")
+	}
+	err = mgr.GetCache().IndexField(&apps.AppRollout{}, fieldIndexSelectorKeys, indexSelectorKeys)
+	if err != nil {
+		return errors.Wrap(err, "add field indexer")
+	}
 
 	err = c.Watch(
 		&source.Kind{Type: &apps.AppRollout{}},
@@ -85,6 +124,27 @@ func Add(mgr manager.Manager, baseValues chartutil.Values) error {
 	if err != nil {
 		return errors.Wrap(err, "watch AppRollouts")
 	}
+	// The ChartAssignments of dependent rollouts reference the ones
+	// generated for their dependencies, which only change with the spec.
+	err = c.Watch(
+		&source.Kind{Type: &apps.AppRollout{}},
+		&handler.Funcs{
+			CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueDependents(e.Meta, q)
+			},
+			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+				if e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() {
+					r.enqueueDependents(e.MetaNew, q)
+				}
+			},
+			DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueDependents(e.Meta, q)
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch AppRollout dependencies")
+	}
 	// We don't trigger on ChartAssignment creations since it was either ourselves
 	// or a CA we don't care about anyway.
 	err = c.Watch(
@@ -105,33 +165,33 @@ func Add(mgr manager.Manager, baseValues chartutil.Values) error {
 	if err != nil {
 		return errors.Wrap(err, "watch ChartAssignments")
 	}
-	// Determining which rollouts are affected by a robot change is tedious.
-	// We just enqueue all AppRollouts again.
+	// Robot changes only enqueue the rollouts whose selectors match the
+	// robot's old or new labels. The requests are delayed to handle changes
+	// of many robots with a single reconcile.
 	err = c.Watch(
 		&source.Kind{Type: &registry.Robot{}},
-		// We log robot events for now while b/125308238 persists.
-		// To mitigate the effects we defer enqueueing in the delete handler
-		// so the robot ideally reappeared before we reconcile.
+		// We log robot events for now while b/125308238 persists. To
+		// mitigate its effects, the ChartAssignments of deleted robots are
+		// kept for a grace period, see keepDeletedRobots.
 		&handler.Funcs{
 			CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
 				log.Printf("AppRollout controller received create event for Robot %q", e.Meta.GetName())
-				r.enqueueAll(q)
+				r.enqueueForRobot(q, robotBatchPeriod, e.Meta)
 			},
 			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
 				// Robots don't have the status subresource enabled. Filter updates that didn't
-				// change robot name or labels.
-				change := !reflect.DeepEqual(e.MetaOld.GetLabels(), e.MetaNew.GetLabels())
-				change = change || e.MetaOld.GetName() != e.MetaNew.GetName()
+				// change the values passed to the charts or the state that update policies
+				// depend on.
+				change := robotValuesChanged(e.ObjectOld, e.ObjectNew)
+				change = change || idleStateChanged(e.ObjectOld, e.ObjectNew)
 				if change {
 					log.Printf("AppRollout controller received update event for Robot %q", e.MetaNew.GetName())
-					r.enqueueAll(q)
+					r.enqueueForRobot(q, robotBatchPeriod, e.MetaOld, e.MetaNew)
 				}
 			},
 			DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
 				log.Printf("AppRollout controller received delete event for Robot %q", e.Meta.GetName())
-				time.AfterFunc(3*time.Second, func() {
-					r.enqueueAll(q)
-				})
+				r.enqueueForRobot(q, robotBatchPeriod, e.Meta)
 			},
 		},
 	)
@@ -158,7 +218,7 @@ func Add(mgr manager.Manager, baseValues chartutil.Values) error {
 	if err != nil {
 		return errors.Wrap(err, "watch Apps")
 	}
-	return nil
+	return addBundleController(mgr)
 }
 
 // enqueueForApp enqueues all AppRollouts for the given app.
@@ -176,6 +236,21 @@ func (r *Reconciler) enqueueForApp(m metav1.Object, q workqueue.RateLimitingInte
 	}
 }
 
+// enqueueDependents enqueues all AppRollouts that depend on the given one.
+func (r *Reconciler) enqueueDependents(m metav1.Object, q workqueue.RateLimitingInterface) {
+	var rollouts apps.AppRolloutList
+	err := r.kube.List(context.TODO(), &rollouts, kclient.MatchingField(fieldIndexDependsOn, m.GetName()))
+	if err != nil {
+		log.Printf("List AppRollouts depending on %s failed: %s", m.GetName(), err)
+		return
+	}
+	for _, ar := range rollouts.Items {
+		q.Add(reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: ar.Name},
+		})
+	}
+}
+
 // enqueueForOwner enqueues AppRollouts that are listed in the owner references
 // of the given resource metadata.
 func (r *Reconciler) enqueueForOwner(m metav1.Object, q workqueue.RateLimitingInterface) {
@@ -188,26 +263,14 @@ func (r *Reconciler) enqueueForOwner(m metav1.Object, q workqueue.RateLimitingIn
 	}
 }
 
-// enqueueAll enqueues all AppRollouts.
-func (r *Reconciler) enqueueAll(q workqueue.RateLimitingInterface) {
-	var rollouts apps.AppRolloutList
-	err := r.kube.List(context.TODO(), &rollouts)
-	if err != nil {
-		log.Printf("List AppRollouts failed: %s", err)
-		return
-	}
-	for _, ar := range rollouts.Items {
-		q.Add(reconcile.Request{
-			NamespacedName: types.NamespacedName{Name: ar.Name},
-		})
-	}
-}
-
 // Reconciler provides an idempotent function that brings the cluster into a
 // state consistent with the specification of an AppRollout.
 type Reconciler struct {
 	kube       kclient.Client
 	baseValues chartutil.Values
+	// robotDeletionGracePeriod is how long the ChartAssignments of deleted
+	// robots are kept.
+	robotDeletionGracePeriod time.Duration
 }
 
 func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
@@ -232,7 +295,6 @@ func (r *Reconciler) reconcile(ctx context.Context, ar *apps.AppRollout) (reconc
 	var (
 		app    apps.App
 		curCAs apps.ChartAssignmentList
-		robots registry.RobotList
 	)
 	ar.Status.ObservedGeneration = ar.Generation
 	ar.Status.Assignments = 0
@@ -248,26 +310,136 @@ func (r *Reconciler) reconcile(ctx context.Context, ar *apps.AppRollout) (reconc
 	if err != nil {
 		return reconcile.Result{}, errors.Wrapf(err, "list ChartAssignments for owner UID %s", ar.UID)
 	}
-	// NOTE(freinartz): consider pushing this down to generateChartAssignments
-	// and passing the robot selectors directly to the client.
-	if err := r.kube.List(ctx, &robots); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "list all Robots")
+	// Only list the robots matched by the current spec and the one a halted
+	// rollout rolls back to.
+	robots, err := r.listRobots(ctx, rolloutSpecs(ar)...)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if ar.Spec.Paused {
+		// Keep the existing ChartAssignments untouched but report their status.
+		setCondition(ar, apps.AppRolloutConditionPaused, core.ConditionTrue, "")
+		setStatus(ar, len(curCAs.Items), curCAs.Items)
+
+		if err := r.kube.Status().Update(ctx, ar); err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "update status")
+		}
+		return reconcile.Result{}, nil
+	}
+	setCondition(ar, apps.AppRolloutConditionPaused, core.ConditionFalse, "")
+
+	if wait := scheduledIn(ar, time.Now()); wait > 0 {
+		// Keep the ChartAssignments of the previous spec until the
+		// activation time.
+		msg := fmt.Sprintf("spec is applied at %s", ar.Spec.Schedule.ActivationTime.UTC().Format(time.RFC3339))
+		setCondition(ar, apps.AppRolloutConditionPending, core.ConditionTrue, msg)
+		setStatus(ar, len(curCAs.Items), curCAs.Items)
+
+		if err := r.kube.Status().Update(ctx, ar); err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "update status")
+		}
+		return reconcile.Result{RequeueAfter: wait}, nil
 	}
+	setCondition(ar, apps.AppRolloutConditionPending, core.ConditionFalse, "")
 
-	wantCAs, err := generateChartAssignments(&app, ar, robots.Items, r.baseValues)
+	wantCAs, err := r.wantChartAssignments(ctx, &app, ar, robots)
 	if err != nil {
-		if _, ok := errors.Cause(err).(errRobotSelectorOverlap); ok {
+		switch errors.Cause(err).(type) {
+		case errMissingDependency, errRobotSelectorOverlap, errRenderValues, errUnknownChannel:
 			return reconcile.Result{}, r.updateErrorStatus(ctx, ar, err.Error())
 		}
-		return reconcile.Result{}, errors.Wrap(err, "generate ChartAssignments")
+		return reconcile.Result{}, err
 	}
+	selected, err := selectRobots(ar, robots)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	setSelectedRobots(ar, selected)
 
 	// ChartAssignments that are no longer wanted. We pre-populate it with
 	// all existing CAs and remove those that we want to keep
 	dropCAs := map[string]apps.ChartAssignment{}
+	byName := map[string]apps.ChartAssignment{}
 
 	for _, ca := range curCAs.Items {
 		dropCAs[ca.Name] = ca
+		byName[ca.Name] = ca
+	}
+	if ar.Status.HaltedGeneration != ar.Generation {
+		reason, err := checkFailurePolicy(ar.Spec.FailurePolicy, wantCAs, byName)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "check failure policy")
+		}
+		if reason != "" {
+			haltRollout(ar, reason)
+		} else {
+			setCondition(ar, apps.AppRolloutConditionHalted, core.ConditionFalse, "")
+		}
+	}
+	var (
+		skipCAs      map[string]bool
+		requeueAfter time.Duration
+		now          = time.Now()
+	)
+	if ar.Status.HaltedGeneration != ar.Generation {
+		// Robots whose update policy doesn't allow an update right now keep
+		// their current ChartAssignments and are left out of rollout
+		// batches until they allow it.
+		gated, gateRequeue, err := gateUpdates(ar, wantCAs, byName, robots, now)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "check update policies")
+		}
+		// With a rollout strategy, robots that wait for a later batch keep
+		// their current ChartAssignments.
+		skipCAs, requeueAfter, err = planRollout(ar, wantCAs, byName, gated, now)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "plan rollout")
+		}
+		if gateRequeue > 0 && (requeueAfter == 0 || gateRequeue < requeueAfter) {
+			requeueAfter = gateRequeue
+		}
+	}
+	if ar.Status.HaltedGeneration == ar.Generation {
+		// A halted rollout leaves the ChartAssignments untouched, unless it
+		// returns to the last Ready spec.
+		if !rollsBack(ar) {
+			setStatus(ar, len(curCAs.Items), curCAs.Items)
+
+			if err := r.kube.Status().Update(ctx, ar); err != nil {
+				return reconcile.Result{}, errors.Wrap(err, "update status")
+			}
+			return reconcile.Result{}, nil
+		}
+		prev := ar.DeepCopy()
+		prev.Spec = *ar.Status.LastReady.Spec.DeepCopy()
+
+		var prevApp apps.App
+		if err := r.kube.Get(ctx, kclient.ObjectKey{Name: prev.Spec.AppName}, &prevApp); err != nil {
+			return reconcile.Result{}, r.updateErrorStatus(ctx, ar, errors.Wrap(err, "roll back").Error())
+		}
+		wantCAs, err = r.wantChartAssignments(ctx, withChannels(&prevApp, ar.Status.LastReady.Channels), prev, robots)
+		if err != nil {
+			switch errors.Cause(err).(type) {
+			case errMissingDependency, errRobotSelectorOverlap, errRenderValues, errUnknownChannel:
+				return reconcile.Result{}, r.updateErrorStatus(ctx, ar, errors.Wrap(err, "roll back").Error())
+			}
+			return reconcile.Result{}, errors.Wrap(err, "roll back")
+		}
+		// Update policies also apply when rolling back.
+		skipCAs, requeueAfter, err = gateUpdates(ar, wantCAs, byName, robots, now)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "check update policies")
+		}
+	}
+	// Record the spec once all its ChartAssignments are Ready to return
+	// to it if a later generation is halted.
+	if ar.Status.HaltedGeneration != ar.Generation && len(skipCAs) == 0 && allReady(wantCAs, byName) {
+		ar.Status.LastReady = &apps.AppRolloutLastReady{
+			Generation: ar.Generation,
+			Spec:       *ar.Spec.DeepCopy(),
+			Channels:   usedChannels(&app, &ar.Spec),
+		}
 	}
 	// Create or update ChartAssignments. Only update ChartAssignments if the rollout's
 	// spec or labels have been updated.
@@ -284,6 +456,10 @@ func (r *Reconciler) reconcile(ctx context.Context, ar *apps.AppRollout) (reconc
 		prev, exists := dropCAs[ca.Name]
 		delete(dropCAs, ca.Name)
 
+		if skipCAs[ca.Name] {
+			continue
+		}
+
 		if !exists {
 			if err := r.kube.Create(ctx, ca); err != nil {
 				return reconcile.Result{}, errors.Wrapf(err, "create ChartAssignment %q", ca.Name)
@@ -302,6 +478,13 @@ func (r *Reconciler) reconcile(ctx context.Context, ar *apps.AppRollout) (reconc
 		}
 		log.Printf("Updated ChartAssignment %q", ca.Name)
 	}
+	graceRequeue, err := r.keepDeletedRobots(ctx, ar, dropCAs, now)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if graceRequeue > 0 && (requeueAfter == 0 || graceRequeue < requeueAfter) {
+		requeueAfter = graceRequeue
+	}
 	// Delete obsolete assignments.
 	for _, ca := range dropCAs {
 		if err := r.kube.Delete(ctx, &ca); err != nil {
@@ -315,7 +498,9 @@ func (r *Reconciler) reconcile(ctx context.Context, ar *apps.AppRollout) (reconc
 	if err := r.kube.Status().Update(ctx, ar); err != nil {
 		return reconcile.Result{}, errors.Wrap(err, "update status")
 	}
-	return reconcile.Result{}, nil
+	// Check back when the current batch reaches its deadline, the next
+	// maintenance window opens or the grace period of a deleted robot ends.
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 
 func (r *Reconciler) updateErrorStatus(ctx context.Context, ar *apps.AppRollout, msg string) error {
@@ -330,6 +515,8 @@ func setStatus(ar *apps.AppRollout, numWantCAs int, curCAs []apps.ChartAssignmen
 	// Update status.
 	ar.Status.Assignments = int64(numWantCAs)
 
+	var unready []apps.AppRolloutUnreadyCluster
+
 	for _, ca := range curCAs {
 		switch ca.Status.Phase {
 		case apps.ChartAssignmentPhaseReady:
@@ -340,6 +527,31 @@ func setStatus(ar *apps.AppRollout, numWantCAs int, curCAs []apps.ChartAssignmen
 		case apps.ChartAssignmentPhaseFailed:
 			ar.Status.FailedAssignments++
 		}
+		if ca.Status.Phase != apps.ChartAssignmentPhaseReady {
+			unready = append(unready, apps.AppRolloutUnreadyCluster{
+				Name:    ca.Spec.ClusterName,
+				Phase:   ca.Status.Phase,
+				Message: unreadyMessage(&ca),
+			})
+		}
+	}
+	// List failed clusters first, so that they are kept when truncating.
+	sort.Slice(unready, func(i, j int) bool {
+		fi := unready[i].Phase == apps.ChartAssignmentPhaseFailed
+		fj := unready[j].Phase == apps.ChartAssignmentPhaseFailed
+		if fi != fj {
+			return fi
+		}
+		return unready[i].Name < unready[j].Name
+	})
+	if len(unready) > maxUnreadyClusters {
+		unready = unready[:maxUnreadyClusters]
+	}
+	ar.Status.UnreadyClusters = unready
+
+	ar.Status.Summary = fmt.Sprintf("%d/%d ready", ar.Status.ReadyAssignments, ar.Status.Assignments)
+	if n := ar.Status.FailedAssignments; n > 0 {
+		ar.Status.Summary += fmt.Sprintf(", %d failed", n)
 	}
 	if got, want := ar.Status.SettledAssignments, ar.Status.Assignments; got == want {
 		setCondition(ar, apps.AppRolloutConditionSettled, core.ConditionTrue, "")
@@ -355,6 +567,17 @@ func setStatus(ar *apps.AppRollout, numWantCAs int, curCAs []apps.ChartAssignmen
 	}
 }
 
+// unreadyMessage returns the message of the first condition of the
+// ChartAssignment that isn't true.
+func unreadyMessage(ca *apps.ChartAssignment) string {
+	for _, c := range ca.Status.Conditions {
+		if c.Status != core.ConditionTrue && c.Message != "" {
+			return c.Message
+		}
+	}
+	return ""
+}
+
 // setCondition adds or updates a condition. Existing conditions are detected based on the Type field.
 func setCondition(ar *apps.AppRollout, t apps.AppRolloutConditionType, s core.ConditionStatus, msg string) {
 	now := metav1.Now()
@@ -410,6 +633,86 @@ func (r errRobotSelectorOverlap) Error() string {
 	return fmt.Sprintf("robot %q was selected multiple times", string(r))
 }
 
+type errUnknownChannel struct {
+	app     string
+	channel string
+}
+
+func (e errUnknownChannel) Error() string {
+	return fmt.Sprintf("App %q has no channel %q", e.app, e.channel)
+}
+
+// appChannel returns the App with the repository, version and components of
+// the given channel. The empty channel is the App's own version.
+func appChannel(app *apps.App, channel string) (*apps.App, error) {
+	if channel == "" {
+		return app, nil
+	}
+	for _, ch := range app.Spec.Channels {
+		if ch.Name != channel {
+			continue
+		}
+		res := app.DeepCopy()
+		res.Spec = apps.AppSpec{
+			Repository: app.Spec.Repository,
+			Version:    ch.Version,
+			Components: ch.Components,
+		}
+		if ch.Repository != "" {
+			res.Spec.Repository = ch.Repository
+		}
+		return res, nil
+	}
+	return nil, errUnknownChannel{app: app.Name, channel: channel}
+}
+
+// usedChannels returns the channels of the App that the spec uses, with
+// their repository resolved.
+func usedChannels(app *apps.App, spec *apps.AppRolloutSpec) []apps.AppChannel {
+	used := map[string]bool{spec.Cloud.Channel: true}
+	for _, r := range spec.Robots {
+		used[r.Channel] = true
+	}
+	var res []apps.AppChannel
+	for _, ch := range app.Spec.Channels {
+		if !used[ch.Name] {
+			continue
+		}
+		c := *ch.DeepCopy()
+		if c.Repository == "" {
+			c.Repository = app.Spec.Repository
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// withChannels returns a copy of the App in which the given channels replace
+// the ones of the same name or are added if the App no longer has them.
+func withChannels(app *apps.App, channels []apps.AppChannel) *apps.App {
+	res := app.DeepCopy()
+outer:
+	for _, ch := range channels {
+		for i := range res.Spec.Channels {
+			if res.Spec.Channels[i].Name == ch.Name {
+				res.Spec.Channels[i] = *ch.DeepCopy()
+				continue outer
+			}
+		}
+		res.Spec.Channels = append(res.Spec.Channels, *ch.DeepCopy())
+	}
+	return res
+}
+
+type errRenderValues struct {
+	robot string
+	err   error
+}
+
+func (e errRenderValues) Error() string {
+	return fmt.Sprintf("render values for robot %q: %s", e.robot, e.err)
+}
+
 // generateChartAssignments returns a list of all cloud and robot ChartAssignments
 // for the given app, its rollout, and set of robots.
 func generateChartAssignments(
@@ -418,50 +721,200 @@ func generateChartAssignments(
 	allRobots []registry.Robot,
 	baseValues chartutil.Values,
 ) ([]*apps.ChartAssignment, error) {
+	var cas []*apps.ChartAssignment
+
+	selected, err := selectRobots(rollout, allRobots)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range selected {
+		spec := &rollout.Spec.Robots[s.entry]
+		robotApp, err := appChannel(app, spec.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if comp := robotApp.Spec.Components.Robot; comp.Name != "" || comp.Inline != "" {
+			ca, err := newRobotChartAssignment(s.robot, robotApp, rollout, spec, baseValues)
+			if err != nil {
+				return nil, err
+			}
+			cas = append(cas, ca)
+		}
+	}
+	cloudApp, err := appChannel(app, rollout.Spec.Cloud.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if comp := cloudApp.Spec.Components.Cloud; comp.Name != "" || comp.Inline != "" {
+		ca, err := newCloudChartAssignment(cloudApp, rollout, baseValues, selected)
+		if err != nil {
+			return nil, err
+		}
+		cas = append(cas, ca)
+	}
+	sort.Slice(cas, func(i, j int) bool {
+		return cas[i].Name < cas[j].Name
+	})
+	return cas, nil
+}
+
+// selectedRobot is a robot and the index of the entry in spec.robots that
+// selected it.
+type selectedRobot struct {
+	robot *registry.Robot
+	entry int
+	// overlap is true if the robot matched several entries.
+	overlap bool
+}
+
+// selectRobots returns the robots selected by the rollout, sorted by name.
+// A robot that matches several entries of spec.robots is selected by the one
+// with the highest priority. If several entries share the highest priority,
+// the rollout's selector overlap policy decides.
+func selectRobots(rollout *apps.AppRollout, allRobots []registry.Robot) ([]selectedRobot, error) {
 	var (
-		cas   []*apps.ChartAssignment
-		comps = app.Spec.Components
-		// Robots that matched selectors for the rollout and which will be
-		// passed to the cloud chart.
-		selectedRobots = map[string]*registry.Robot{}
+		entries = rollout.Spec.Robots
+		matches = map[string][]int{}
+		robots  = map[string]*registry.Robot{}
 	)
-	for _, rcomp := range rollout.Spec.Robots {
-		robots, err := matchingRobots(allRobots, rcomp.Selector)
+	for i := range entries {
+		matched, err := matchingRobots(allRobots, entries[i].Selector)
 		if err != nil {
 			return nil, errors.Wrap(err, "select robots")
 		}
-		for i := range robots {
-			// Ensure we don't pass a pointer to the most recent loop item.
-			r := &robots[i]
-			// No robot must be selected multiple times.
-			if _, ok := selectedRobots[r.Name]; ok {
-				return nil, errRobotSelectorOverlap(r.Name)
+		for j := range matched {
+			// Ensure we don't keep a pointer to the most recent loop item.
+			r := &matched[j]
+			robots[r.Name] = r
+			matches[r.Name] = append(matches[r.Name], i)
+		}
+	}
+	// Sort the robots so we produce deterministic outputs.
+	// (Go randomizes map iteration.)
+	names := make([]string, 0, len(robots))
+	for name := range robots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selected := make([]selectedRobot, 0, len(names))
+	for _, name := range names {
+		best := matches[name][0]
+		for _, i := range matches[name][1:] {
+			if entries[i].Priority > entries[best].Priority {
+				best = i
 			}
-			selectedRobots[r.Name] = r
-
-			if comps.Robot.Name != "" || comps.Robot.Inline != "" {
-				cas = append(cas, newRobotChartAssignment(r, app, rollout, &rcomp, baseValues))
+		}
+		// Unless the first match wins, no robot must be selected by
+		// multiple entries with the same priority.
+		if rollout.Spec.SelectorOverlap != apps.SelectorOverlapFirstMatch {
+			for _, i := range matches[name] {
+				if i != best && entries[i].Priority == entries[best].Priority {
+					return nil, errRobotSelectorOverlap(name)
+				}
 			}
 		}
+		selected = append(selected, selectedRobot{
+			robot:   robots[name],
+			entry:   best,
+			overlap: len(matches[name]) > 1,
+		})
 	}
-	if comps.Cloud.Name != "" || comps.Cloud.Inline != "" {
-		// Turn robot map into a sorted slice so we produce deterministic outputs.
-		// (Go randomizes map iteration.)
-		robots := make([]*registry.Robot, 0, len(selectedRobots))
-		for _, r := range selectedRobots {
-			robots = append(robots, r)
+	return selected, nil
+}
+
+// setSelectedRobots records which entry of spec.robots selected the robots
+// that matched several entries. Others were selected by their only match.
+func setSelectedRobots(ar *apps.AppRollout, selected []selectedRobot) {
+	ar.Status.Robots = nil
+	ar.Status.OverlappingRobots = 0
+	for _, s := range selected {
+		if !s.overlap {
+			continue
+		}
+		ar.Status.OverlappingRobots++
+		if len(ar.Status.Robots) < maxOverlappingRobots {
+			ar.Status.Robots = append(ar.Status.Robots, apps.AppRolloutRobotStatus{
+				Name:  s.robot.Name,
+				Entry: int32(s.entry),
+			})
 		}
-		sort.Slice(robots, func(i, j int) bool {
-			return robots[i].Name < robots[j].Name
-		})
-		cas = append(cas, newCloudChartAssignment(app, rollout, baseValues, robots...))
 	}
-	sort.Slice(cas, func(i, j int) bool {
-		return cas[i].Name < cas[j].Name
-	})
+}
+
+// wantChartAssignments returns the ChartAssignments for the given app and
+// rollout, which depend on the ones of the rollout's dependencies.
+func (r *Reconciler) wantChartAssignments(ctx context.Context, app *apps.App, ar *apps.AppRollout, robots []registry.Robot) ([]*apps.ChartAssignment, error) {
+	cas, err := generateChartAssignments(app, ar, robots, r.baseValues)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate ChartAssignments")
+	}
+	depCAs, err := r.dependencyChartAssignments(ctx, ar, robots)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate ChartAssignments of dependencies")
+	}
+	setDependsOn(cas, ar.Spec.DependsOn, depCAs)
 	return cas, nil
 }
 
+type errMissingDependency string
+
+func (e errMissingDependency) Error() string {
+	return string(e)
+}
+
+// dependencyChartAssignments returns the names of the ChartAssignments that
+// are generated for the AppRollouts the given one depends on.
+func (r *Reconciler) dependencyChartAssignments(ctx context.Context, ar *apps.AppRollout, robots []registry.Robot) (map[string]bool, error) {
+	names := map[string]bool{}
+	for _, name := range ar.Spec.DependsOn {
+		var (
+			dep apps.AppRollout
+			app apps.App
+		)
+		if err := r.kube.Get(ctx, kclient.ObjectKey{Name: name}, &dep); err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil, errMissingDependency(fmt.Sprintf("dependency AppRollout %q not found", name))
+			}
+			return nil, errors.Wrapf(err, "get AppRollout %q", name)
+		}
+		if err := r.kube.Get(ctx, kclient.ObjectKey{Name: dep.Spec.AppName}, &app); err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil, errMissingDependency(fmt.Sprintf("App %q of dependency AppRollout %q not found", dep.Spec.AppName, name))
+			}
+			return nil, errors.Wrapf(err, "get App %q", dep.Spec.AppName)
+		}
+		cas, err := generateChartAssignments(&app, &dep, robots, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "dependency AppRollout %q", name)
+		}
+		for _, ca := range cas {
+			names[ca.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// setDependsOn makes each ChartAssignment depend on the ChartAssignments of
+// the dependencies for the same cluster. Dependencies that have no
+// ChartAssignment for a cluster are skipped.
+func setDependsOn(cas []*apps.ChartAssignment, dependsOn []string, depCAs map[string]bool) {
+	for _, ca := range cas {
+		ca.Spec.DependsOn = nil
+		for _, dep := range dependsOn {
+			var name string
+			if ca.Spec.ClusterName == "cloud" {
+				name = chartAssignmentName(dep, compTypeCloud, "")
+			} else {
+				name = chartAssignmentName(dep, compTypeRobot, ca.Spec.ClusterName)
+			}
+			if depCAs[name] {
+				ca.Spec.DependsOn = append(ca.Spec.DependsOn, name)
+			}
+		}
+	}
+}
+
 // newCloudChartAssignment generates a new ChartAssignment for the cloud cluster
 // from an app, it's rollout, a set of base configuration values,
 // and a list of robots matched by the rollout.
@@ -469,39 +922,50 @@ func newCloudChartAssignment(
 	app *apps.App,
 	rollout *apps.AppRollout,
 	values chartutil.Values,
-	robots ...*registry.Robot,
-) *apps.ChartAssignment {
+	robots []selectedRobot,
+) (*apps.ChartAssignment, error) {
 	ca := newBaseChartAssignment(app, rollout, &app.Spec.Components.Cloud)
 
 	ca.Name = chartAssignmentName(rollout.Name, compTypeCloud, "")
 	ca.Spec.ClusterName = "cloud"
 
 	// Generate robot values list that's injected into the cloud chart.
-	var robotValuesList []robotValues
-	for _, r := range robots {
-		robotValuesList = append(robotValuesList, robotValues{
-			Name: r.Name,
-		})
+	var robotValuesList []cloudRobotValues
+	for _, s := range robots {
+		rv, err := newCloudRobotValues(s.robot, &rollout.Spec.Robots[s.entry])
+		if err != nil {
+			return nil, err
+		}
+		robotValuesList = append(robotValuesList, rv)
 	}
 	vals := chartutil.Values{}
 	vals.MergeInto(values)
 	vals.MergeInto(chartutil.Values(rollout.Spec.Cloud.Values))
-	vals.MergeInto(chartutil.Values{"robots": robotValuesList})
+	robotsVal, err := jsonValue(robotValuesList)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode robot values")
+	}
+	vals.MergeInto(chartutil.Values{"robots": robotsVal})
 
 	ca.Spec.Chart.Values = apps.ConfigValues(vals)
+	ca.Spec.Chart.ValuesFrom = append([]apps.ValuesFromSource(nil), rollout.Spec.Cloud.ValuesFrom...)
+	ca.Spec.ImagePull = rollout.Spec.Cloud.ImagePull.DeepCopy()
+	ca.Spec.Namespace = rollout.Spec.Cloud.Namespace.DeepCopy()
+	ca.Spec.AllowedNamespaces = append([]string(nil), rollout.Spec.Cloud.AllowedNamespaces...)
 
-	return ca
+	return ca, nil
 }
 
 // newRobotChartAssignment generates a new ChartAssignment for a robot cluster
-// from an app, its rollout, and a set of base configuration values.
+// from an app, its rollout, and a set of base configuration values. Templates
+// in the valuesTemplate of the rollout are rendered with the robot's values.
 func newRobotChartAssignment(
 	robot *registry.Robot,
 	app *apps.App,
 	rollout *apps.AppRollout,
 	spec *apps.AppRolloutSpecRobot,
 	values chartutil.Values,
-) *apps.ChartAssignment {
+) (*apps.ChartAssignment, error) {
 	ca := newBaseChartAssignment(app, rollout, &app.Spec.Components.Robot)
 
 	ca.Name = chartAssignmentName(rollout.Name, compTypeRobot, robot.Name)
@@ -511,15 +975,29 @@ func newRobotChartAssignment(
 	if spec.Version != "" {
 		ca.Spec.Chart.Version = spec.Version
 	}
+	ca.Spec.Rollback = spec.Rollback.DeepCopy()
 
+	robotVals := newRobotValues(robot)
+	specVals, err := robotSpecValues(spec, robotVals)
+	if err != nil {
+		return nil, errRenderValues{robot: robot.Name, err: err}
+	}
 	vals := chartutil.Values{}
 	vals.MergeInto(values)
-	vals.MergeInto(chartutil.Values(spec.Values))
-	vals.MergeInto(chartutil.Values{"robot": robotValues{Name: robot.Name}})
+	vals.MergeInto(chartutil.Values(specVals))
+	robotVal, err := jsonValue(robotVals)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode robot values")
+	}
+	vals.MergeInto(chartutil.Values{"robot": robotVal})
 
 	ca.Spec.Chart.Values = apps.ConfigValues(vals)
+	ca.Spec.Chart.ValuesFrom = append([]apps.ValuesFromSource(nil), spec.ValuesFrom...)
+	ca.Spec.ImagePull = spec.ImagePull.DeepCopy()
+	ca.Spec.Namespace = spec.Namespace.DeepCopy()
+	ca.Spec.AllowedNamespaces = append([]string(nil), spec.AllowedNamespaces...)
 
-	return ca
+	return ca, nil
 }
 
 // newChartAssignments returns a new ChartAssignments that's initialized with
@@ -591,12 +1069,6 @@ func chartAssignmentName(rollout string, typ componentType, robot string) string
 	return fmt.Sprintf("%s-%s", rollout, typ)
 }
 
-// robotValues is the struct that is passed into the cloud chart configuration
-// for each robot matched by a rollout.
-type robotValues struct {
-	Name string `json:"name"`
-}
-
 func setLabel(o *metav1.ObjectMeta, k, v string) {
 	if o.Labels == nil {
 		o.Labels = map[string]string{}
@@ -625,8 +1097,11 @@ func setOwnerReference(om *metav1.ObjectMeta, ref metav1.OwnerReference) {
 
 // indexOwnerReferences indexes resources by the UIDs of their owner references.
 func indexOwnerReferences(o runtime.Object) (vs []string) {
-	ca := o.(*apps.ChartAssignment)
-	for _, or := range ca.OwnerReferences {
+	m, ok := o.(metav1.Object)
+	if !ok {
+		return nil
+	}
+	for _, or := range m.GetOwnerReferences() {
 		vs = append(vs, string(or.UID))
 	}
 	return vs
@@ -637,14 +1112,31 @@ func indexAppName(o runtime.Object) []string {
 	return []string{ar.Spec.AppName}
 }
 
+func indexDependsOn(o runtime.Object) []string {
+	return o.(*apps.AppRollout).Spec.DependsOn
+}
+
 // NewValidationWebhook returns a new webhook that validates AppRollouts.
-func NewValidationWebhook(mgr manager.Manager) *admission.Webhook {
-	return &admission.Webhook{Handler: newAppRolloutValidator(mgr.GetScheme())}
+// The base values are the ones passed to the controller and are used to
+// validate the values against the schemas of the App's charts. System
+// namespaces such as kube-system are only accepted in allowedNamespaces if
+// allowSystemNamespaces is set.
+func NewValidationWebhook(mgr manager.Manager, baseValues chartutil.Values, allowSystemNamespaces bool) *admission.Webhook {
+	v := newAppRolloutValidator(mgr.GetScheme())
+	v.allowSystemNamespaces = allowSystemNamespaces
+	// Apps, AppRollouts and Robots are watched by the controller, so reading
+	// them from its cache avoids listing all Robots on every admission.
+	v.kube = mgr.GetClient()
+	v.baseValues = baseValues
+	return &admission.Webhook{Handler: v}
 }
 
 // appRolloutValidator implements a validation webhook.
 type appRolloutValidator struct {
-	decoder runtime.Decoder
+	decoder               runtime.Decoder
+	kube                  kclient.Reader
+	baseValues            chartutil.Values
+	allowSystemNamespaces bool
 }
 
 func newAppRolloutValidator(sc *runtime.Scheme) *appRolloutValidator {
@@ -653,7 +1145,7 @@ func newAppRolloutValidator(sc *runtime.Scheme) *appRolloutValidator {
 	}
 }
 
-func (v *appRolloutValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+func (v *appRolloutValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
 	cur := &apps.AppRollout{}
 
 	if err := runtime.DecodeInto(v.decoder, req.AdmissionRequest.Object.Raw, cur); err != nil {
@@ -662,9 +1154,168 @@ func (v *appRolloutValidator) Handle(_ context.Context, req admission.Request) a
 	if err := validate(cur); err != nil {
 		return admission.Denied(err.Error())
 	}
+	if !v.allowSystemNamespaces {
+		if errs := validateNoSystemNamespaces(cur); len(errs) > 0 {
+			return admission.Denied(errs.ToAggregate().Error())
+		}
+	}
+	if cur.DeletionTimestamp != nil || v.kube == nil {
+		return admission.Allowed("")
+	}
+	if cycle, err := dependencyCycle(ctx, v.kube, cur); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	} else if cycle != nil {
+		return admission.Denied(fmt.Sprintf("dependency cycle: %s", strings.Join(cycle, " -> ")))
+	}
+	// The App may not exist yet, in which case the values are validated
+	// when the chart is rendered.
+	var (
+		app    apps.App
+		robots registry.RobotList
+	)
+	if err := v.kube.Get(ctx, kclient.ObjectKey{Name: cur.Spec.AppName}, &app); err != nil {
+		return admission.Allowed("")
+	}
+	if err := v.kube.List(ctx, &robots); err != nil {
+		return admission.Errored(http.StatusInternalServerError, errors.Wrap(err, "list all Robots"))
+	}
+	if errs := validateValues(&app, cur, robots.Items, v.baseValues); len(errs) > 0 {
+		return admission.Denied(errs.ToAggregate().Error())
+	}
 	return admission.Allowed("")
 }
 
+// dependencyCycle returns the AppRollouts that form a cycle through
+// spec.dependsOn with the given one, or nil if there is none. AppRollouts that
+// don't exist yet are ignored, as they are checked when they are created.
+func dependencyCycle(ctx context.Context, kube kclient.Reader, cur *apps.AppRollout) ([]string, error) {
+	visited := map[string]bool{}
+	var visit func(path []string, deps []string) ([]string, error)
+	visit = func(path []string, deps []string) ([]string, error) {
+		for _, name := range deps {
+			p := append(path[:len(path):len(path)], name)
+			if name == cur.Name {
+				return p, nil
+			}
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+
+			var dep apps.AppRollout
+			if err := kube.Get(ctx, kclient.ObjectKey{Name: name}, &dep); err != nil {
+				if k8serrors.IsNotFound(err) {
+					continue
+				}
+				return nil, errors.Wrapf(err, "get AppRollout %q", name)
+			}
+			if cycle, err := visit(p, dep.Spec.DependsOn); err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit([]string{cur.Name}, cur.Spec.DependsOn)
+}
+
+// validateValues validates the values of the ChartAssignments generated for
+// the rollout against the schemas of the App's charts. The values of a
+// robot depend on its metadata through valuesTemplate, so each distinct set
+// of values is validated. Robots whose values only differ in the robot's
+// name are validated once, and only the first invalid robot of each entry
+// is reported.
+func validateValues(app *apps.App, rollout *apps.AppRollout, allRobots []registry.Robot, baseValues chartutil.Values) field.ErrorList {
+	var errs field.ErrorList
+	robotApps := make([]*apps.App, len(rollout.Spec.Robots))
+	for i, rcomp := range rollout.Spec.Robots {
+		robotApp, err := appChannel(app, rcomp.Channel)
+		if err != nil {
+			errs = append(errs, field.NotFound(field.NewPath("spec", "robots").Index(i).Child("channel"), rcomp.Channel))
+			continue
+		}
+		if comp := robotApp.Spec.Components.Robot; comp.Name != "" || comp.Inline != "" {
+			robotApps[i] = robotApp
+		}
+	}
+	cloudApp, cloudErr := appChannel(app, rollout.Spec.Cloud.Channel)
+
+	// Overlapping selectors are reported by validate, skip
+	// the values in that case since the selected robots are ambiguous.
+	selected, err := selectRobots(rollout, allRobots)
+	if err != nil {
+		if cloudErr != nil {
+			errs = append(errs, field.NotFound(field.NewPath("spec", "cloud", "channel"), rollout.Spec.Cloud.Channel))
+		}
+		return errs
+	}
+	var (
+		validated = map[string]bool{}
+		invalid   = map[int]bool{}
+	)
+	for _, s := range selected {
+		robotApp := robotApps[s.entry]
+		if robotApp == nil || invalid[s.entry] {
+			continue
+		}
+		rcomp := &rollout.Spec.Robots[s.entry]
+		fldPath := field.NewPath("spec", "robots").Index(s.entry).Child("values")
+		ca, err := newRobotChartAssignment(s.robot, robotApp, rollout, rcomp, baseValues)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath, rcomp.Values, err.Error()))
+			invalid[s.entry] = true
+			continue
+		}
+		key, err := valuesKey(s.entry, ca.Spec.Chart.Values)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath, rcomp.Values, err.Error()))
+			invalid[s.entry] = true
+			continue
+		}
+		if validated[key] {
+			continue
+		}
+		validated[key] = true
+		if valErrs := chartassignment.ValidateValues(&ca.Spec.Chart, fldPath); len(valErrs) > 0 {
+			errs = append(errs, valErrs...)
+			invalid[s.entry] = true
+		}
+	}
+	if cloudErr != nil {
+		return append(errs, field.NotFound(field.NewPath("spec", "cloud", "channel"), rollout.Spec.Cloud.Channel))
+	}
+	if comp := cloudApp.Spec.Components.Cloud; comp.Name != "" || comp.Inline != "" {
+		fldPath := field.NewPath("spec", "cloud", "values")
+		ca, err := newCloudChartAssignment(cloudApp, rollout, baseValues, selected)
+		if err != nil {
+			return append(errs, field.Invalid(fldPath, rollout.Spec.Cloud.Values, err.Error()))
+		}
+		errs = append(errs, chartassignment.ValidateValues(&ca.Spec.Chart, fldPath)...)
+	}
+	return errs
+}
+
+// valuesKey identifies the values of a robot's ChartAssignment, generated
+// for the given entry of spec.robots, regardless of the robot's name.
+func valuesKey(entry int, vals apps.ConfigValues) (string, error) {
+	v := make(map[string]interface{}, len(vals))
+	for k, e := range vals {
+		v[k] = e
+	}
+	if robot, ok := v["robot"].(map[string]interface{}); ok {
+		r := make(map[string]interface{}, len(robot))
+		for k, e := range robot {
+			r[k] = e
+		}
+		delete(r, "name")
+		v["robot"] = r
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", entry, b), nil
+}
+
 func validate(cur *apps.AppRollout) error {
 	if cur.Spec.AppName == "" {
 		return errors.New("app name missing")
@@ -676,6 +1327,46 @@ func validate(cur *apps.AppRollout) error {
 	if _, ok := cur.Spec.Cloud.Values["robots"]; ok {
 		return errors.Errorf(".spec.cloud.values.robots is a reserved field and must not be set")
 	}
+	if err := validateValuesFrom(cur.Spec.Cloud.ValuesFrom); err != nil {
+		return errors.Wrap(err, ".spec.cloud.valuesFrom")
+	}
+	if err := validateImagePull(cur.Spec.Cloud.ImagePull); err != nil {
+		return errors.Wrap(err, ".spec.cloud.imagePull")
+	}
+	if errs := chartassignment.ValidateNamespace(cur.Spec.Cloud.Namespace, field.NewPath("spec", "cloud", "namespace")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if errs := chartassignment.ValidateDependsOn(cur.Name, cur.Spec.DependsOn, field.NewPath("spec", "dependsOn")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if p := cur.Spec.FailurePolicy; p != nil {
+		if err := validateMaxFailed(p.MaxFailed); err != nil {
+			return errors.Wrap(err, ".spec.failurePolicy.maxFailed")
+		}
+	}
+	if s := cur.Spec.Schedule; s != nil && s.ActivationTime.IsZero() {
+		return errors.New(".spec.schedule.activationTime missing")
+	}
+	switch cur.Spec.SelectorOverlap {
+	case "", apps.SelectorOverlapReject, apps.SelectorOverlapFirstMatch:
+	default:
+		return errors.Errorf(".spec.selectorOverlap must be %q or %q", apps.SelectorOverlapReject, apps.SelectorOverlapFirstMatch)
+	}
+	if s := cur.Spec.Strategy; s != nil {
+		if err := validateBatchSize(s.Canary); err != nil {
+			return errors.Wrap(err, ".spec.strategy.canary")
+		}
+		if err := validateBatchSize(s.BatchSize); err != nil {
+			return errors.Wrap(err, ".spec.strategy.batchSize")
+		}
+		if s.DeadlineSeconds < 0 {
+			return errors.New(".spec.strategy.deadlineSeconds must not be negative")
+		}
+	}
+	nsName := appNamespaceName(cur.Name)
+	if errs := chartassignment.ValidateAllowedNamespaces(nsName, cur.Spec.Cloud.AllowedNamespaces, field.NewPath("spec", "cloud", "allowedNamespaces")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
 	for i, r := range cur.Spec.Robots {
 		if _, ok := r.Values["robot"]; ok {
 			return errors.Errorf(".spec.robots[].values.robot is a reserved field and must not be set")
@@ -688,6 +1379,55 @@ func validate(cur *apps.AppRollout) error {
 		if r.Selector.Any == nil && r.Selector.LabelSelector == nil {
 			return errors.Errorf("empty selector for robots %d (matchLabels not specified?)", i)
 		}
+		if r.Rollback != nil && r.Rollback.DeadlineSeconds < 0 {
+			return errors.Errorf("negative rollback deadline for robots %d", i)
+		}
+		if err := validateValuesFrom(r.ValuesFrom); err != nil {
+			return errors.Wrapf(err, "valuesFrom for robots %d", i)
+		}
+		if err := validateImagePull(r.ImagePull); err != nil {
+			return errors.Wrapf(err, "imagePull for robots %d", i)
+		}
+		if err := validateUpdatePolicy(r.UpdatePolicy); err != nil {
+			return errors.Wrapf(err, "updatePolicy for robots %d", i)
+		}
+		if errs := chartassignment.ValidateNamespace(r.Namespace, field.NewPath("spec", "robots").Index(i).Child("namespace")); len(errs) > 0 {
+			return errs.ToAggregate()
+		}
+		if errs := chartassignment.ValidateAllowedNamespaces(nsName, r.AllowedNamespaces, field.NewPath("spec", "robots").Index(i).Child("allowedNamespaces")); len(errs) > 0 {
+			return errs.ToAggregate()
+		}
+	}
+	return nil
+}
+
+// validateNoSystemNamespaces rejects system namespaces in the
+// allowedNamespaces of the rollout's ChartAssignments.
+func validateNoSystemNamespaces(ar *apps.AppRollout) field.ErrorList {
+	errs := chartassignment.ValidateNoSystemNamespaces(ar.Spec.Cloud.AllowedNamespaces, field.NewPath("spec", "cloud", "allowedNamespaces"))
+	for i, r := range ar.Spec.Robots {
+		errs = append(errs, chartassignment.ValidateNoSystemNamespaces(r.AllowedNamespaces, field.NewPath("spec", "robots").Index(i).Child("allowedNamespaces"))...)
+	}
+	return errs
+}
+
+func validateValuesFrom(srcs []apps.ValuesFromSource) error {
+	for i, src := range srcs {
+		if err := chartassignment.ValidateValuesFrom(src); err != nil {
+			return errors.Wrapf(err, "source %d", i)
+		}
+	}
+	return nil
+}
+
+func validateImagePull(ip *apps.ChartAssignmentImagePull) error {
+	if ip == nil {
+		return nil
+	}
+	for i, reg := range ip.Registries {
+		if reg.Host == "" {
+			return errors.Errorf("host missing for registry %d", i)
+		}
 	}
 	return nil
 }
@@ -15,13 +15,25 @@
 package approllout
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
 	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubetest"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/helm/pkg/chartutil"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 	"sigs.k8s.io/yaml"
 )
 
@@ -83,13 +95,27 @@ spec:
       any: true
     values:
       foo1: bar1
+      alert: "{{ $labels.instance }} is down"
+    valuesTemplate:
+      site: "{{ .robot.labels.site }}"
+      owner: '{{ .robot.annotations.owner | default "nobody" }}'
     version: 1.2.4
+    rollback:
+      deadlineSeconds: 300
  `)
 
 	var robot registry.Robot
 	unmarshalYAML(t, &robot, `
 metadata:
   name: robot1
+  labels:
+    site: munich
+  annotations:
+    values.cloudrobotics.com/owner: alice
+    cloudrobotics.com/active-mission: deliver-parcel
+spec:
+  type: mir-100
+  project: my-project
 	`)
 
 	baseValues := chartutil.Values{
@@ -116,11 +142,25 @@ spec:
     values:
       robot:
         name: robot1
+        type: mir-100
+        project: my-project
+        labels:
+          site: munich
+        annotations:
+          owner: alice
       foo1: bar1
       foo2: bar2
+      alert: "{{ $labels.instance }} is down"
+      site: munich
+      owner: alice
+  rollback:
+    deadlineSeconds: 300
 	`)
 
-	result := newRobotChartAssignment(&robot, &app, &rollout, &rollout.Spec.Robots[0], baseValues)
+	result, err := newRobotChartAssignment(&robot, &app, &rollout, &rollout.Spec.Robots[0], baseValues)
+	if err != nil {
+		t.Fatal(err)
+	}
 	verifyChartAssignment(t, &expected, result)
 }
 
@@ -153,12 +193,36 @@ spec:
     values:
       robots: should_be_overwritten
       foo1: bar1
+    valuesFrom:
+    - kind: Secret
+      name: foo-credentials
+    imagePull:
+      registries:
+      - host: registry.example.com
+        secretName: example-registry
+    namespace:
+      labels:
+        istio-injection: enabled
+      resourceQuota:
+        hard:
+          pods: "10"
+    allowedNamespaces: [monitoring]
+  robots:
+  - selector:
+      matchLabels:
+        site: munich
+    valuesTemplate:
+      endpoint: "{{ .robot.name }}.example.com"
+  - selector:
+      any: true
  `)
 
 	var robot1, robot2 registry.Robot
 	unmarshalYAML(t, &robot1, `
 metadata:
   name: robot1
+  labels:
+    site: munich
 	`)
 	unmarshalYAML(t, &robot2, `
 metadata:
@@ -188,12 +252,37 @@ spec:
     values:
       robots:
       - name: robot1
+        labels:
+          site: munich
+        values:
+          endpoint: robot1.example.com
       - name: robot2
       foo1: bar1
       foo2: bar2
+    valuesFrom:
+    - kind: Secret
+      name: foo-credentials
+  imagePull:
+    registries:
+    - host: registry.example.com
+      secretName: example-registry
+  namespace:
+    labels:
+      istio-injection: enabled
+    resourceQuota:
+      hard:
+        pods: "10"
+  allowedNamespaces: [monitoring]
 	`)
 
-	result := newCloudChartAssignment(&app, &rollout, baseValues, &robot1, &robot2)
+	robots := []selectedRobot{
+		{robot: &robot1, entry: 0},
+		{robot: &robot2, entry: 1},
+	}
+	result, err := newCloudChartAssignment(&app, &rollout, baseValues, robots)
+	if err != nil {
+		t.Fatal(err)
+	}
 	verifyChartAssignment(t, &expected, result)
 }
 
@@ -274,6 +363,10 @@ spec:
       robots:
       - name: robot1
       - name: robot3
+        labels:
+          a: c
+        values:
+          foo3: bar3
 	`)
 	unmarshalYAML(t, &expected[1], `
 metadata:
@@ -303,6 +396,8 @@ spec:
     values:
       robot:
         name: robot3
+        labels:
+          a: c
       foo2: bar2
       foo3: bar3
       `)
@@ -429,23 +524,377 @@ spec:
 	}
 }
 
+func TestGenerateChartAssignments_channels(t *testing.T) {
+	var app apps.App
+	unmarshalYAML(t, &app, `
+metadata:
+  name: foo
+spec:
+  repository: https://example.org/helm
+  version: 1.0.0
+  components:
+    cloud:
+      name: foo-cloud
+    robot:
+      name: foo-robot
+  channels:
+  - name: beta
+    version: 2.0.0-beta.1
+    components:
+      cloud:
+        inline: inline-cloud
+      robot:
+        name: foo-robot-next
+  - name: canary
+    repository: https://example.org/canary
+    version: 2.0.0-rc.1
+    components:
+      cloud:
+        name: foo-cloud
+	`)
+
+	var robots [3]registry.Robot
+	for i := range robots {
+		robots[i].Name = fmt.Sprintf("robot%d", i+1)
+		robots[i].Labels = map[string]string{"channel": []string{"stable", "beta", "canary"}[i]}
+	}
+	var rollout apps.AppRollout
+	unmarshalYAML(t, &rollout, `
+metadata:
+  name: foo-rollout
+spec:
+  appName: foo
+  cloud:
+    channel: beta
+  robots:
+  - selector:
+      matchLabels:
+        channel: stable
+  - selector:
+      matchLabels:
+        channel: beta
+    channel: beta
+  # The canary channel has no robot component.
+  - selector:
+      matchLabels:
+        channel: canary
+    channel: canary
+	`)
+
+	cas, err := generateChartAssignments(&app, &rollout, robots[:], nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %s", err)
+	}
+	got := map[string]apps.AssignedChart{}
+	for _, ca := range cas {
+		ca.Spec.Chart.Values = nil
+		got[ca.Name] = ca.Spec.Chart
+	}
+	want := map[string]apps.AssignedChart{
+		"foo-rollout-cloud":        {Inline: "inline-cloud"},
+		"foo-rollout-robot-robot1": {Repository: "https://example.org/helm", Version: "1.0.0", Name: "foo-robot"},
+		"foo-rollout-robot-robot2": {Repository: "https://example.org/helm", Version: "2.0.0-beta.1", Name: "foo-robot-next"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected charts %+v but got %+v", want, got)
+	}
+
+	rollout.Spec.Robots[0].Channel = "nightly"
+	_, err = generateChartAssignments(&app, &rollout, robots[:], nil)
+	if exp := (errUnknownChannel{app: "foo", channel: "nightly"}); err != exp {
+		t.Errorf("Expected error %q but got %v", exp, err)
+	}
+	errs := validateValues(&app, &rollout, robots[:], nil)
+	if len(errs) != 1 || errs[0].Field != "spec.robots[0].channel" {
+		t.Errorf("Expected error for spec.robots[0].channel, got %v", errs)
+	}
+}
+
+func TestSelectRobots(t *testing.T) {
+	var robots [3]registry.Robot
+	unmarshalYAML(t, &robots[0], `
+metadata:
+  name: robot1
+	`)
+	unmarshalYAML(t, &robots[1], `
+metadata:
+  name: robot2
+  labels:
+    type: mir
+	`)
+	unmarshalYAML(t, &robots[2], `
+metadata:
+  name: robot3
+  labels:
+    type: mir
+    location: lab
+	`)
+
+	cases := []struct {
+		name    string
+		rollout string
+		entries []int
+		err     error
+	}{
+		{
+			name: "priority",
+			rollout: `
+spec:
+  robots:
+  - selector:
+      any: true
+  - selector:
+      matchLabels:
+        type: mir
+    priority: 10
+  - selector:
+      matchLabels:
+        location: lab
+    priority: 20
+`,
+			entries: []int{0, 1, 2},
+		},
+		{
+			name: "same-priority",
+			rollout: `
+spec:
+  robots:
+  - selector:
+      any: true
+  - selector:
+      matchLabels:
+        type: mir
+    priority: 10
+  - selector:
+      matchLabels:
+        location: lab
+    priority: 10
+`,
+			err: errRobotSelectorOverlap("robot3"),
+		},
+		{
+			name: "lower-priorities-may-overlap",
+			rollout: `
+spec:
+  robots:
+  - selector:
+      any: true
+  - selector:
+      matchLabels:
+        type: mir
+  - selector:
+      matchLabels:
+        location: lab
+    priority: 1
+`,
+			err: errRobotSelectorOverlap("robot2"),
+		},
+		{
+			name: "first-match",
+			rollout: `
+spec:
+  selectorOverlap: FirstMatch
+  robots:
+  - selector:
+      matchLabels:
+        type: mir
+  - selector:
+      any: true
+  - selector:
+      matchLabels:
+        location: lab
+    priority: 1
+`,
+			entries: []int{1, 0, 2},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var rollout apps.AppRollout
+			unmarshalYAML(t, &rollout, c.rollout)
+
+			selected, err := selectRobots(&rollout, robots[:])
+			if err != c.err {
+				t.Fatalf("expected error %v but got %v", c.err, err)
+			}
+			if c.err != nil {
+				return
+			}
+			var entries []int
+			for i, s := range selected {
+				if want := robots[i].Name; s.robot.Name != want {
+					t.Errorf("expected robot %q at %d, got %q", want, i, s.robot.Name)
+				}
+				entries = append(entries, s.entry)
+			}
+			if !reflect.DeepEqual(entries, c.entries) {
+				t.Errorf("expected entries %v, got %v", c.entries, entries)
+			}
+		})
+	}
+}
+
+func TestSetSelectedRobots(t *testing.T) {
+	var selected []selectedRobot
+	for i := 0; i < 4*maxOverlappingRobots; i++ {
+		robot := &registry.Robot{}
+		robot.Name = fmt.Sprintf("robot%02d", i)
+		// Every other robot only matched the default entry.
+		selected = append(selected, selectedRobot{robot: robot, entry: i % 2, overlap: i%2 == 1})
+	}
+	ar := &apps.AppRollout{}
+	setSelectedRobots(ar, selected)
+
+	if got, want := ar.Status.OverlappingRobots, int64(2*maxOverlappingRobots); got != want {
+		t.Errorf("want %d overlapping robots, got %d", want, got)
+	}
+	if got := len(ar.Status.Robots); got != maxOverlappingRobots {
+		t.Fatalf("want %d listed robots, got %d", maxOverlappingRobots, got)
+	}
+	if want := (apps.AppRolloutRobotStatus{Name: "robot01", Entry: 1}); ar.Status.Robots[0] != want {
+		t.Errorf("want first robot %+v, got %+v", want, ar.Status.Robots[0])
+	}
+}
+
+func TestSetDependsOn(t *testing.T) {
+	var cas [3]apps.ChartAssignment
+	unmarshalYAML(t, &cas[0], `
+metadata:
+  name: foo-cloud
+spec:
+  clusterName: cloud
+	`)
+	unmarshalYAML(t, &cas[1], `
+metadata:
+  name: foo-robot-robot1
+spec:
+  clusterName: robot1
+	`)
+	unmarshalYAML(t, &cas[2], `
+metadata:
+  name: foo-robot-robot2
+spec:
+  clusterName: robot2
+	`)
+	// The "crds" rollout has no robot component and "db" is not rolled
+	// out to robot2.
+	depCAs := map[string]bool{
+		"crds-cloud":      true,
+		"db-cloud":        true,
+		"db-robot-robot1": true,
+	}
+	setDependsOn([]*apps.ChartAssignment{&cas[0], &cas[1], &cas[2]}, []string{"crds", "db"}, depCAs)
+
+	want := [][]string{
+		{"crds-cloud", "db-cloud"},
+		{"db-robot-robot1"},
+		nil,
+	}
+	for i, ca := range cas {
+		if !reflect.DeepEqual(ca.Spec.DependsOn, want[i]) {
+			t.Errorf("%s: want dependsOn %v, got %v", ca.Name, want[i], ca.Spec.DependsOn)
+		}
+	}
+}
+
+// rolloutReader returns AppRollouts from a map.
+type rolloutReader map[string]*apps.AppRollout
+
+func (r rolloutReader) Get(_ context.Context, key kclient.ObjectKey, obj runtime.Object) error {
+	ar, ok := r[key.Name]
+	if !ok {
+		return k8serrors.NewNotFound(apps.Resource("approllouts"), key.Name)
+	}
+	ar.DeepCopyInto(obj.(*apps.AppRollout))
+	return nil
+}
+
+func (r rolloutReader) List(context.Context, runtime.Object, ...kclient.ListOption) error {
+	panic("not implemented")
+}
+
+func TestDependencyCycle(t *testing.T) {
+	newRollout := func(name string, deps ...string) *apps.AppRollout {
+		ar := &apps.AppRollout{}
+		ar.Name = name
+		ar.Spec.DependsOn = deps
+		return ar
+	}
+	kube := rolloutReader{
+		"a": newRollout("a", "b"),
+		"b": newRollout("b", "c", "missing"),
+		"c": newRollout("c"),
+	}
+	cases := []struct {
+		name string
+		cur  *apps.AppRollout
+		want []string
+	}{
+		{
+			name: "no-dependencies",
+			cur:  newRollout("c"),
+		},
+		{
+			name: "no-cycle",
+			cur:  newRollout("a", "b"),
+		},
+		{
+			name: "direct-cycle",
+			cur:  newRollout("c", "a"),
+			want: []string{"c", "a", "b", "c"},
+		},
+		{
+			name: "cycle-through-update",
+			cur:  newRollout("b", "a"),
+			want: []string{"b", "a", "b"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := dependencyCycle(context.Background(), kube, c.cur)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want cycle %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
 func TestSetStatus(t *testing.T) {
 	var ca1, ca2, ca3 apps.ChartAssignment
 	unmarshalYAML(t, &ca1, `
 metadata:
   name: ca1
+spec:
+  clusterName: robot2
 status:
   phase: Failed
+  conditions:
+  - type: Settled
+    status: "False"
+    message: "install failed: timed out"
 	`)
 	unmarshalYAML(t, &ca2, `
 metadata:
   name: ca2
+spec:
+  clusterName: robot1
 status:
   phase: Settled
+  conditions:
+  - type: Settled
+    status: "True"
+  - type: Ready
+    status: "False"
+    message: "1/2 pods running"
 	`)
 	unmarshalYAML(t, &ca3, `
 metadata:
   name: ca3
+spec:
+  clusterName: robot3
 status:
   phase: Ready
 	`)
@@ -473,34 +922,175 @@ status:
 		c.Status != core.ConditionFalse {
 		t.Errorf("Unexpected second condition %v, expected Ready=False")
 	}
+	wantUnready := []apps.AppRolloutUnreadyCluster{
+		{Name: "robot2", Phase: apps.ChartAssignmentPhaseFailed, Message: "install failed: timed out"},
+		{Name: "robot1", Phase: apps.ChartAssignmentPhaseSettled, Message: "1/2 pods running"},
+	}
+	if !reflect.DeepEqual(ar.Status.UnreadyClusters, wantUnready) {
+		t.Errorf("Expected .status.unreadyClusters to be %v but got %v", wantUnready, ar.Status.UnreadyClusters)
+	}
+	if want := "1/100 ready, 1 failed"; ar.Status.Summary != want {
+		t.Errorf("Expected .status.summary to be %q but got %q", want, ar.Status.Summary)
+	}
 }
 
-func TestValidate(t *testing.T) {
-	cases := []struct {
-		name       string
-		cur        string
-		shouldFail bool
-	}{
-		{
-			name: "valid-all",
-			cur: `
+func TestSetStatus_boundsUnreadyClusters(t *testing.T) {
+	var cas []apps.ChartAssignment
+	for i := 0; i < 2*maxUnreadyClusters; i++ {
+		var ca apps.ChartAssignment
+		ca.Spec.ClusterName = fmt.Sprintf("robot%02d", 2*maxUnreadyClusters-i)
+		cas = append(cas, ca)
+	}
+	// The failed cluster sorts last by name, but is listed first.
+	cas[0].Status.Phase = apps.ChartAssignmentPhaseFailed
+
+	var ar apps.AppRollout
+	setStatus(&ar, len(cas), cas)
+
+	if got := len(ar.Status.UnreadyClusters); got != maxUnreadyClusters {
+		t.Fatalf("Expected %d unready clusters but got %d", maxUnreadyClusters, got)
+	}
+	if got := ar.Status.UnreadyClusters[0].Name; got != "robot40" {
+		t.Errorf("Expected first unready cluster robot40 but got %q", got)
+	}
+	if got := ar.Status.UnreadyClusters[1].Name; got != "robot01" {
+		t.Errorf("Expected second unready cluster robot01 but got %q", got)
+	}
+	if want := "0/40 ready, 1 failed"; ar.Status.Summary != want {
+		t.Errorf("Expected .status.summary to be %q but got %q", want, ar.Status.Summary)
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	inline := kubetest.BuildInlineChartFromFiles(t, map[string]string{
+		"foo/Chart.yaml": "{apiVersion: v2, name: foo, version: 0.0.1}",
+		"foo/values.schema.json": `{
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "robots": {"type": "array", "minItems": 1},
+    "site": {"type": "string", "minLength": 1}
+  }
+}`,
+	})
+	var app apps.App
+	unmarshalYAML(t, &app, `
+metadata:
+  name: foo
 spec:
-  appName: myapp
+  components:
+    cloud:
+      inline: `+inline+`
+    robot:
+      inline: `+inline+`
+	`)
+	var robots [1]registry.Robot
+	unmarshalYAML(t, &robots[0], `
+metadata:
+  name: robot1
+	`)
+	var rollout apps.AppRollout
+	unmarshalYAML(t, &rollout, `
+metadata:
+  name: foo-rollout
+spec:
+  appName: foo
   cloud:
     values:
-      a: 2
-      b: {c: 3}
+      replicas: 1
   robots:
   - selector:
       any: true
     values:
-      c: d
+      replicas: 0
+  # Matches no robots and is therefore not validated.
   - selector:
       matchLabels:
-        abc: def
-        foo: bar
+        a: b
+    values:
+      replicas: -1
+	`)
+
+	errs := validateValues(&app, &rollout, robots[:], nil)
+	if len(errs) != 1 || errs[0].Field != "spec.robots[0].values.replicas" {
+		t.Errorf("want error for spec.robots[0].values.replicas, got %v", errs)
+	}
+	// The cloud chart requires at least one robot.
+	errs = validateValues(&app, &rollout, nil, nil)
+	if len(errs) != 1 || errs[0].Field != "spec.cloud.values.robots" {
+		t.Errorf("want error for spec.cloud.values.robots, got %v", errs)
+	}
+
+	// The values of each robot are validated, not only those of the first.
+	var labeled [2]registry.Robot
+	unmarshalYAML(t, &labeled[0], `
+metadata:
+  name: robot1
+  labels:
+    site: a
+	`)
+	unmarshalYAML(t, &labeled[1], `
+metadata:
+  name: robot2
+	`)
+	var templated apps.AppRollout
+	unmarshalYAML(t, &templated, `
+metadata:
+  name: foo-rollout
+spec:
+  appName: foo
+  cloud:
+    values:
+      replicas: 1
+  robots:
   - selector:
-      matchExpressions:
+      any: true
+    valuesTemplate:
+      site: "{{ .robot.labels.site }}"
+	`)
+	errs = validateValues(&app, &templated, labeled[:], nil)
+	if len(errs) != 1 || errs[0].Field != "spec.robots[0].values.site" {
+		t.Errorf("want error for spec.robots[0].values.site, got %v", errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name       string
+		cur        string
+		shouldFail bool
+	}{
+		{
+			name: "depends-on-itself",
+			cur: `
+metadata:
+  name: foo
+spec:
+  appName: myapp
+  dependsOn: [foo]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-all",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    values:
+      a: 2
+      b: {c: 3}
+  robots:
+  - selector:
+      any: true
+    values:
+      c: d
+  - selector:
+      matchLabels:
+        abc: def
+        foo: bar
+  - selector:
+      matchExpressions:
       - {key: foo, Op: DoesExist}
 	`,
 		},
@@ -532,6 +1122,24 @@ spec:
   robots:
   - values:
       a: b
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-schedule",
+			cur: `
+spec:
+  appName: myapp
+  schedule:
+    activationTime: "2020-06-13T02:00:00Z"
+	`,
+		},
+		{
+			name: "schedule-without-activation-time",
+			cur: `
+spec:
+  appName: myapp
+  schedule: {}
 	`,
 			shouldFail: true,
 		},
@@ -569,6 +1177,101 @@ spec:
     values:
       robot:
         c: d
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-values-from",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    valuesFrom:
+    - kind: ConfigMap
+      name: cloud-config
+  robots:
+  - selector:
+      any: true
+    valuesFrom:
+    - kind: Secret
+      name: robot-credentials
+      targetPath: credentials.key
+	`,
+		},
+		{
+			name: "values-from-invalid-kind",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    valuesFrom:
+    - kind: Pod
+      name: foo
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "values-from-missing-name",
+			cur: `
+spec:
+  appName: myapp
+  robots:
+  - selector:
+      any: true
+    valuesFrom:
+    - kind: Secret
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "values-from-invalid-target-path",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    valuesFrom:
+    - kind: Secret
+      name: foo
+      targetPath: credentials..key
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "values-from-invalid-namespace",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    valuesFrom:
+    - kind: Secret
+      name: foo
+      namespace: Not_A_Namespace
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "allowed-namespaces-own-namespace",
+			cur: `
+metadata:
+  name: foo
+spec:
+  appName: myapp
+  cloud:
+    allowedNamespaces: [app-foo]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "namespace-reserved-annotation",
+			cur: `
+spec:
+  appName: myapp
+  robots:
+  - selector:
+      any: true
+    namespace:
+      annotations:
+        cloudrobotics.com/managed-labels: foo
 	`,
 			shouldFail: true,
 		},
@@ -588,3 +1291,333 @@ spec:
 		})
 	}
 }
+
+func TestAppRolloutValidator_rejectsSystemNamespaces(t *testing.T) {
+	if err := apps.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name                  string
+		cur                   string
+		allowSystemNamespaces bool
+		allowed               bool
+	}{
+		{
+			name: "cloud-kube-system",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    allowedNamespaces: [kube-system]
+	`,
+		},
+		{
+			name: "robot-default",
+			cur: `
+spec:
+  appName: myapp
+  robots:
+  - selector:
+      any: true
+    allowedNamespaces: [monitoring, default]
+	`,
+		},
+		{
+			name: "allowed-by-operator",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    allowedNamespaces: [kube-system]
+	`,
+			allowSystemNamespaces: true,
+			allowed:               true,
+		},
+		{
+			name: "other-namespace",
+			cur: `
+spec:
+  appName: myapp
+  cloud:
+    allowedNamespaces: [monitoring]
+	`,
+			allowed: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cur apps.AppRollout
+			unmarshalYAML(t, &cur, c.cur)
+			cur.APIVersion = "apps.cloudrobotics.com/v1alpha1"
+			cur.Kind = "AppRollout"
+			cur.Name = "foo"
+			raw, err := json.Marshal(&cur)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := newAppRolloutValidator(scheme.Scheme)
+			v.allowSystemNamespaces = c.allowSystemNamespaces
+
+			resp := v.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1beta1.AdmissionRequest{
+					Object: runtime.RawExtension{Raw: raw},
+				},
+			})
+			if resp.Allowed != c.allowed {
+				t.Errorf("expected allowed=%t, got %t: %v", c.allowed, resp.Allowed, resp.Result)
+			}
+		})
+	}
+}
+
+// newFakeClient returns a fake client holding the objects. The fake client
+// decodes objects with the client-go scheme and ignores field selectors.
+func newFakeClient(t *testing.T, objs ...runtime.Object) kclient.Client {
+	t.Helper()
+	if err := apps.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+}
+
+func TestReconcile_paused(t *testing.T) {
+	var app apps.App
+	unmarshalYAML(t, &app, `
+metadata:
+  name: foo
+spec:
+  components:
+    robot:
+      inline: inline-robot
+	`)
+	var robot1, robot2 registry.Robot
+	unmarshalYAML(t, &robot1, `
+metadata:
+  name: robot1
+	`)
+	unmarshalYAML(t, &robot2, `
+metadata:
+  name: robot2
+	`)
+	var ca apps.ChartAssignment
+	unmarshalYAML(t, &ca, `
+metadata:
+  name: foo-rollout-robot-robot1
+spec:
+  clusterName: robot1
+  namespaceName: app-foo-rollout
+  chart:
+    inline: outdated
+status:
+  phase: Ready
+	`)
+	cases := []struct {
+		name    string
+		rollout string
+		// Expected ChartAssignments after the reconcile.
+		wantCAs []string
+		paused  core.ConditionStatus
+	}{
+		{
+			name: "paused",
+			rollout: `
+metadata:
+  name: foo-rollout
+  generation: 2
+spec:
+  appName: foo
+  paused: true
+  robots:
+  - selector:
+      any: true
+	`,
+			wantCAs: []string{"foo-rollout-robot-robot1"},
+			paused:  core.ConditionTrue,
+		},
+		{
+			name: "unpaused",
+			rollout: `
+metadata:
+  name: foo-rollout
+  generation: 2
+spec:
+  appName: foo
+  robots:
+  - selector:
+      any: true
+	`,
+			wantCAs: []string{"foo-rollout-robot-robot1", "foo-rollout-robot-robot2"},
+			paused:  core.ConditionFalse,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			var ar apps.AppRollout
+			unmarshalYAML(t, &ar, c.rollout)
+
+			kube := newFakeClient(t, &app, &robot1, &robot2, ca.DeepCopy(), &ar)
+			r := &Reconciler{kube: kube}
+
+			if err := kube.Get(ctx, kclient.ObjectKey{Name: ar.Name}, &ar); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.reconcile(ctx, &ar); err != nil {
+				t.Fatal(err)
+			}
+			var cas apps.ChartAssignmentList
+			if err := kube.List(ctx, &cas); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, ca := range cas.Items {
+				names = append(names, ca.Name)
+			}
+			if !reflect.DeepEqual(names, c.wantCAs) {
+				t.Errorf("want ChartAssignments %v, got %v", c.wantCAs, names)
+			}
+			var got apps.ChartAssignment
+			if err := kube.Get(ctx, kclient.ObjectKey{Name: ca.Name}, &got); err != nil {
+				t.Fatal(err)
+			}
+			if paused := c.paused == core.ConditionTrue; paused != (got.Spec.Chart.Inline == "outdated") {
+				t.Errorf("unexpected chart %q of existing ChartAssignment", got.Spec.Chart.Inline)
+			}
+			if err := kube.Get(ctx, kclient.ObjectKey{Name: ar.Name}, &ar); err != nil {
+				t.Fatal(err)
+			}
+			if cond := condition(ar.Status.Conditions, apps.AppRolloutConditionPaused); cond == nil || cond.Status != c.paused {
+				t.Errorf("want Paused condition %q, got %+v", c.paused, cond)
+			}
+			if ar.Status.Assignments != int64(len(c.wantCAs)) {
+				t.Errorf("want %d assignments in status, got %d", len(c.wantCAs), ar.Status.Assignments)
+			}
+		})
+	}
+}
+
+func TestReconcile_rollsBackEditedChannel(t *testing.T) {
+	// The stable channel was edited in place after generation 1 became
+	// Ready, and the rollout of generation 2 was halted.
+	var app apps.App
+	unmarshalYAML(t, &app, `
+metadata:
+  name: foo
+spec:
+  repository: https://example.org/helm
+  version: 1.0.0
+  channels:
+  - name: stable
+    version: 3.0.0
+    components:
+      robot:
+        name: foo-robot
+	`)
+	var robot registry.Robot
+	unmarshalYAML(t, &robot, `
+metadata:
+  name: robot1
+	`)
+	var ar apps.AppRollout
+	unmarshalYAML(t, &ar, `
+metadata:
+  name: foo-rollout
+  generation: 2
+spec:
+  appName: foo
+  failurePolicy:
+    rollback: true
+  robots:
+  - selector:
+      any: true
+    channel: stable
+    values:
+      replicas: 2
+status:
+  haltedGeneration: 2
+	`)
+	var last apps.AppRollout
+	unmarshalYAML(t, &last, `
+spec:
+  appName: foo
+  robots:
+  - selector:
+      any: true
+    channel: stable
+	`)
+	ar.Status.LastReady = &apps.AppRolloutLastReady{
+		Generation: 1,
+		Spec:       last.Spec,
+		Channels:   []apps.AppChannel{{Name: "stable", Repository: "https://example.org/helm", Version: "2.0.0", Components: app.Spec.Channels[0].Components}},
+	}
+	ctx := context.Background()
+	kube := newFakeClient(t, &app, &robot, &ar)
+	r := &Reconciler{kube: kube}
+
+	if err := kube.Get(ctx, kclient.ObjectKey{Name: ar.Name}, &ar); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reconcile(ctx, &ar); err != nil {
+		t.Fatal(err)
+	}
+	var ca apps.ChartAssignment
+	if err := kube.Get(ctx, kclient.ObjectKey{Name: "foo-rollout-robot-robot1"}, &ca); err != nil {
+		t.Fatal(err)
+	}
+	if got := ca.Spec.Chart.Version; got != "2.0.0" {
+		t.Errorf("want rollback to recorded channel version 2.0.0, got %q", got)
+	}
+	if _, ok := ca.Spec.Chart.Values["replicas"]; ok {
+		t.Errorf("want values of the last Ready spec, got %v", ca.Spec.Chart.Values)
+	}
+}
+
+func TestUsedChannels(t *testing.T) {
+	var app apps.App
+	unmarshalYAML(t, &app, `
+spec:
+  repository: https://example.org/helm
+  channels:
+  - name: stable
+    version: 1.0.0
+  - name: beta
+    repository: https://beta.example.org/helm
+    version: 2.0.0
+  - name: unused
+    version: 3.0.0
+	`)
+	spec := &apps.AppRolloutSpec{
+		Cloud:  apps.AppRolloutSpecCloud{Channel: "beta"},
+		Robots: []apps.AppRolloutSpecRobot{{Channel: "stable"}, {}},
+	}
+	want := []apps.AppChannel{
+		{Name: "stable", Repository: "https://example.org/helm", Version: "1.0.0"},
+		{Name: "beta", Repository: "https://beta.example.org/helm", Version: "2.0.0"},
+	}
+	channels := usedChannels(&app, spec)
+	if !reflect.DeepEqual(channels, want) {
+		t.Errorf("want channels %+v, got %+v", want, channels)
+	}
+
+	// Restored channels replace edited ones and bring back removed ones.
+	app.Spec.Channels = []apps.AppChannel{{Name: "stable", Version: "1.1.0"}}
+	got := withChannels(&app, channels)
+	if !reflect.DeepEqual(got.Spec.Channels, want) {
+		t.Errorf("want restored channels %+v, got %+v", want, got.Spec.Channels)
+	}
+	if app.Spec.Channels[0].Version != "1.1.0" {
+		t.Error("input App was modified")
+	}
+}
+
+func condition(conds []apps.AppRolloutCondition, t apps.AppRolloutConditionType) *apps.AppRolloutCondition {
+	for i := range conds {
+		if conds[i].Type == t {
+			return &conds[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// annotationActiveMission is set on a Robot while it executes a mission.
+// Its value is the name of the mission. It is set and removed by whatever
+// executes missions, see RobotUpdatePolicy.RequireIdle.
+const annotationActiveMission = "cloudrobotics.com/active-mission"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// gateUpdates delays the creation or update of robot ChartAssignments whose
+// update policy doesn't allow it right now. It returns them as gated and
+// lists the robots in the rollout's status. If a robot waits for a
+// maintenance window, requeueAfter is the time until the next one opens.
+func gateUpdates(
+	ar *apps.AppRollout,
+	wantCAs []*apps.ChartAssignment,
+	curCAs map[string]apps.ChartAssignment,
+	robots []registry.Robot,
+	now time.Time,
+) (gated map[string]bool, requeueAfter time.Duration, err error) {
+	type robotPolicy struct {
+		robot  registry.Robot
+		policy *apps.RobotUpdatePolicy
+	}
+	selected, err := selectRobots(ar, robots)
+	if err != nil {
+		return nil, 0, err
+	}
+	policies := map[string]robotPolicy{}
+	for _, s := range selected {
+		if p := ar.Spec.Robots[s.entry].UpdatePolicy; p != nil {
+			policies[s.robot.Name] = robotPolicy{robot: *s.robot, policy: p}
+		}
+	}
+	ar.Status.WaitingRobots = nil
+	gated = map[string]bool{}
+
+	for _, ca := range wantCAs {
+		rp, ok := policies[ca.Spec.ClusterName]
+		if !ok {
+			continue
+		}
+		if cur, ok := curCAs[ca.Name]; ok {
+			if changed, err := chartAssignmentChanged(&cur, ca); err != nil {
+				return nil, 0, errors.Wrap(err, "check ChartAssignment changed")
+			} else if !changed {
+				continue
+			}
+		}
+		reason, wait, err := updateBlocked(&rp.robot, rp.policy, now)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "robot %q", rp.robot.Name)
+		}
+		if reason == "" {
+			continue
+		}
+		gated[ca.Name] = true
+		if len(ar.Status.WaitingRobots) < maxWaitingRobots {
+			ar.Status.WaitingRobots = append(ar.Status.WaitingRobots, apps.AppRolloutWaitingRobot{
+				Name:   rp.robot.Name,
+				Reason: reason,
+			})
+		}
+		if wait > 0 && (requeueAfter == 0 || wait < requeueAfter) {
+			requeueAfter = wait
+		}
+	}
+	return gated, requeueAfter, nil
+}
+
+// updateBlocked returns why the robot must not be updated right now, or an
+// empty string if it may be updated. If the robot is outside of its
+// maintenance windows, wait is the time until the next one opens.
+func updateBlocked(robot *registry.Robot, policy *apps.RobotUpdatePolicy, now time.Time) (reason string, wait time.Duration, err error) {
+	if len(policy.MaintenanceWindows) > 0 {
+		open, wait, err := inMaintenanceWindow(policy.MaintenanceWindows, now)
+		if err != nil {
+			return "", 0, err
+		}
+		if !open {
+			return "outside of maintenance windows", wait, nil
+		}
+	}
+	if policy.RequireIdle {
+		if m := robot.Annotations[annotationActiveMission]; m != "" {
+			return fmt.Sprintf("executing mission %q", m), 0, nil
+		}
+		switch s := robot.Status.Robot.State; s {
+		case registry.RobotStateAvailable:
+		case "":
+			return fmt.Sprintf("robot state is %s", registry.RobotStateUndefined), 0, nil
+		default:
+			return fmt.Sprintf("robot state is %s", s), 0, nil
+		}
+	}
+	return "", 0, nil
+}
+
+// inMaintenanceWindow returns whether now is within one of the windows.
+// Otherwise, it returns the time until the next window opens.
+func inMaintenanceWindow(windows []apps.MaintenanceWindow, now time.Time) (bool, time.Duration, error) {
+	var next time.Duration
+	for _, w := range windows {
+		loc, err := time.LoadLocation(w.TimeZone)
+		if err != nil {
+			return false, 0, err
+		}
+		sh, sm, err := parseTimeOfDay(w.Start)
+		if err != nil {
+			return false, 0, errors.Wrap(err, "start")
+		}
+		eh, em, err := parseTimeOfDay(w.End)
+		if err != nil {
+			return false, 0, errors.Wrap(err, "end")
+		}
+		days := map[time.Weekday]bool{}
+		for _, d := range w.Days {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return false, 0, errors.Errorf("invalid day %q", d)
+			}
+			days[wd] = true
+		}
+		// Windows that started yesterday may still be open, and the next
+		// one starts within a week.
+		y, m, d := now.In(loc).Date()
+		for i := -1; i <= 7; i++ {
+			start := time.Date(y, m, d+i, sh, sm, 0, 0, loc)
+			if len(days) > 0 && !days[start.Weekday()] {
+				continue
+			}
+			end := time.Date(y, m, d+i, eh, em, 0, 0, loc)
+			if !end.After(start) {
+				end = time.Date(y, m, d+i+1, eh, em, 0, 0, loc)
+			}
+			if !now.Before(start) && now.Before(end) {
+				return true, 0, nil
+			}
+			if wait := start.Sub(now); wait > 0 && (next == 0 || wait < next) {
+				next = wait
+			}
+		}
+	}
+	return false, next, nil
+}
+
+// parseTimeOfDay parses a time of the form "HH:MM".
+func parseTimeOfDay(s string) (hour, min int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, errors.Errorf("invalid time %q, want HH:MM", s)
+	}
+	hour, err = strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, errors.Errorf("invalid hour in %q", s)
+	}
+	min, err = strconv.Atoi(parts[1])
+	if err != nil || min < 0 || min > 59 {
+		return 0, 0, errors.Errorf("invalid minute in %q", s)
+	}
+	return hour, min, nil
+}
+
+// validateUpdatePolicy checks that the maintenance windows of the policy
+// can be parsed.
+func validateUpdatePolicy(policy *apps.RobotUpdatePolicy) error {
+	if policy == nil {
+		return nil
+	}
+	for i, w := range policy.MaintenanceWindows {
+		if _, _, err := inMaintenanceWindow([]apps.MaintenanceWindow{w}, time.Now()); err != nil {
+			return errors.Wrapf(err, "maintenanceWindows[%d]", i)
+		}
+	}
+	return nil
+}
+
+// idleStateChanged returns whether a robot update changed the state that
+// update policies depend on.
+func idleStateChanged(old, new runtime.Object) bool {
+	o, ok := old.(*registry.Robot)
+	if !ok {
+		return false
+	}
+	n, ok := new.(*registry.Robot)
+	if !ok {
+		return false
+	}
+	return o.Status.Robot.State != n.Status.Robot.State ||
+		o.Annotations[annotationActiveMission] != n.Annotations[annotationActiveMission]
+}
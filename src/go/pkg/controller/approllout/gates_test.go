@@ -0,0 +1,198 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInMaintenanceWindow(t *testing.T) {
+	// A Saturday.
+	now := time.Date(2020, 6, 13, 10, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		windows []apps.MaintenanceWindow
+		open    bool
+		wait    time.Duration
+	}{
+		{
+			name:    "daily-open",
+			windows: []apps.MaintenanceWindow{{Start: "10:00", End: "11:00"}},
+			open:    true,
+		},
+		{
+			name:    "daily-closed",
+			windows: []apps.MaintenanceWindow{{Start: "12:00", End: "13:00"}},
+			wait:    90 * time.Minute,
+		},
+		{
+			name:    "over-midnight-from-yesterday",
+			windows: []apps.MaintenanceWindow{{Days: []string{"Fri"}, Start: "22:00", End: "11:00"}},
+			open:    true,
+		},
+		{
+			name:    "next-week",
+			windows: []apps.MaintenanceWindow{{Days: []string{"sat"}, Start: "02:00", End: "04:00"}},
+			wait:    7*24*time.Hour - 8*time.Hour - 30*time.Minute,
+		},
+		{
+			name:    "time-zone",
+			windows: []apps.MaintenanceWindow{{Start: "12:00", End: "13:00", TimeZone: "Europe/Berlin"}},
+			open:    true,
+		},
+		{
+			name: "earliest-of-multiple",
+			windows: []apps.MaintenanceWindow{
+				{Days: []string{"Mon"}, Start: "00:00", End: "01:00"},
+				{Days: []string{"Sun"}, Start: "00:00", End: "01:00"},
+			},
+			wait: 13*time.Hour + 30*time.Minute,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			open, wait, err := inMaintenanceWindow(c.windows, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if open != c.open || wait != c.wait {
+				t.Errorf("want (%v, %s), got (%v, %s)", c.open, c.wait, open, wait)
+			}
+		})
+	}
+}
+
+func TestValidateUpdatePolicy(t *testing.T) {
+	invalid := []apps.MaintenanceWindow{
+		{Start: "10:00"},
+		{Start: "24:00", End: "01:00"},
+		{Start: "10:00", End: "11:60"},
+		{Start: "10:00", End: "11:00", Days: []string{"Someday"}},
+		{Start: "10:00", End: "11:00", TimeZone: "Mars/Olympus_Mons"},
+	}
+	for _, w := range invalid {
+		p := &apps.RobotUpdatePolicy{MaintenanceWindows: []apps.MaintenanceWindow{w}}
+		if err := validateUpdatePolicy(p); err == nil {
+			t.Errorf("expected error for %+v", w)
+		}
+	}
+	p := &apps.RobotUpdatePolicy{MaintenanceWindows: []apps.MaintenanceWindow{
+		{Start: "22:00", End: "02:00", Days: []string{"Mon", "tue"}, TimeZone: "America/New_York"},
+	}}
+	if err := validateUpdatePolicy(p); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestGateUpdates(t *testing.T) {
+	now := time.Date(2020, 6, 13, 10, 30, 0, 0, time.UTC)
+	robot := func(name string, state registry.RobotState, mission string) registry.Robot {
+		r := registry.Robot{ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"gated": "true"},
+		}}
+		if mission != "" {
+			r.Annotations = map[string]string{annotationActiveMission: mission}
+		}
+		r.Status.Robot.State = state
+		return r
+	}
+	robots := []registry.Robot{
+		robot("robot1", registry.RobotStateAvailable, ""),
+		robot("robot2", registry.RobotStateAvailable, "deliver-parcel"),
+		robot("robot3", registry.RobotStateEmergencyStop, ""),
+		robot("robot4", "", ""),
+	}
+	// robot5 isn't gated, robot1 is already up to date.
+	robots = append(robots, registry.Robot{ObjectMeta: metav1.ObjectMeta{Name: "robot5"}})
+
+	ar := &apps.AppRollout{}
+	ar.Spec.Robots = []apps.AppRolloutSpecRobot{{
+		Selector: &apps.RobotSelector{LabelSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"gated": "true"},
+		}},
+		UpdatePolicy: &apps.RobotUpdatePolicy{RequireIdle: true},
+	}}
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(5, "1"), nil, true)
+	want := newStrategyTestCAs(5, "2")
+	cur["foo-robot-robot1"] = *want[1].DeepCopy()
+
+	skip, requeueAfter, err := gateUpdates(ar, want, cur, robots, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := skipped(skip), []string{"foo-robot-robot2", "foo-robot-robot3", "foo-robot-robot4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want skipped %v, got %v", want, got)
+	}
+	wantWaiting := []apps.AppRolloutWaitingRobot{
+		{Name: "robot2", Reason: `executing mission "deliver-parcel"`},
+		{Name: "robot3", Reason: "robot state is EMERGENCY_STOP"},
+		{Name: "robot4", Reason: "robot state is UNDEFINED"},
+	}
+	if !reflect.DeepEqual(ar.Status.WaitingRobots, wantWaiting) {
+		t.Errorf("want waiting robots %v, got %v", wantWaiting, ar.Status.WaitingRobots)
+	}
+	if requeueAfter != 0 {
+		t.Errorf("want no requeue, got %s", requeueAfter)
+	}
+
+	// Outside of the maintenance window, all gated robots wait for it.
+	ar.Spec.Robots[0].UpdatePolicy.MaintenanceWindows = []apps.MaintenanceWindow{{Start: "11:00", End: "12:00"}}
+	skip, requeueAfter, err = gateUpdates(ar, want, cur, robots, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := len(skip); got != 3 {
+		t.Errorf("want 3 skipped ChartAssignments, got %v", skipped(skip))
+	}
+	if requeueAfter != 30*time.Minute {
+		t.Errorf("want requeue after 30m, got %s", requeueAfter)
+	}
+}
+
+func TestGateUpdates_limitsWaitingRobots(t *testing.T) {
+	now := time.Date(2020, 6, 13, 10, 30, 0, 0, time.UTC)
+	var robots []registry.Robot
+	for i := 1; i <= 2*maxWaitingRobots; i++ {
+		robots = append(robots, registry.Robot{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("robot%d", i)}})
+	}
+	any := true
+	ar := &apps.AppRollout{}
+	ar.Spec.Robots = []apps.AppRolloutSpecRobot{{
+		Selector:     &apps.RobotSelector{Any: &any},
+		UpdatePolicy: &apps.RobotUpdatePolicy{RequireIdle: true},
+	}}
+	want := newStrategyTestCAs(2*maxWaitingRobots, "2")
+
+	gated, _, err := gateUpdates(ar, want, nil, robots, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := len(gated); got != 2*maxWaitingRobots {
+		t.Errorf("want %d gated ChartAssignments, got %d", 2*maxWaitingRobots, got)
+	}
+	if got := len(ar.Status.WaitingRobots); got != maxWaitingRobots {
+		t.Errorf("want %d waiting robots, got %d", maxWaitingRobots, got)
+	}
+}
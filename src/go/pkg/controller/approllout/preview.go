@@ -0,0 +1,267 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/helm/pkg/chartutil"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// PreviewAction describes what applying an AppRollout does to one of its
+// ChartAssignments.
+type PreviewAction string
+
+const (
+	PreviewCreate    PreviewAction = "create"
+	PreviewUpdate    PreviewAction = "update"
+	PreviewDelete    PreviewAction = "delete"
+	PreviewUnchanged PreviewAction = "unchanged"
+)
+
+// PreviewEntry is a ChartAssignment in the preview of an AppRollout.
+type PreviewEntry struct {
+	Action PreviewAction
+	// Current is the existing ChartAssignment, nil for PreviewCreate.
+	Current *apps.ChartAssignment
+	// Want is the generated ChartAssignment, nil for PreviewDelete.
+	Want *apps.ChartAssignment
+}
+
+// Name returns the name of the ChartAssignment.
+func (e *PreviewEntry) Name() string {
+	if e.Want != nil {
+		return e.Want.Name
+	}
+	return e.Current.Name
+}
+
+// ClusterName returns the cluster the ChartAssignment is installed in.
+func (e *PreviewEntry) ClusterName() string {
+	if e.Want != nil {
+		return e.Want.Spec.ClusterName
+	}
+	return e.Current.Spec.ClusterName
+}
+
+// Diff returns a line diff from the current to the generated labels,
+// annotations, and spec of the ChartAssignment, both rendered as YAML.
+// Removed lines are prefixed with "-", added lines with "+". It is empty if
+// they are equal.
+func (e *PreviewEntry) Diff() (string, error) {
+	cur, err := diffableChartAssignment(e.Current)
+	if err != nil {
+		return "", err
+	}
+	want, err := diffableChartAssignment(e.Want)
+	if err != nil {
+		return "", err
+	}
+	return lineDiff(cur, want), nil
+}
+
+// diffableChartAssignment renders the fields of the ChartAssignment that the
+// AppRollout controller sets as YAML, or returns the empty string for nil.
+func diffableChartAssignment(ca *apps.ChartAssignment) (string, error) {
+	if ca == nil {
+		return "", nil
+	}
+	b, err := yaml.Marshal(map[string]interface{}{
+		"labels":      ca.Labels,
+		"annotations": ca.Annotations,
+		"spec":        ca.Spec,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// diffContext is the number of unchanged lines shown around changed ones.
+const diffContext = 3
+
+// lineDiff returns the lines of a and b based on their longest common
+// subsequence. Lines only in a are prefixed with "- ", lines only in b with
+// "+ ", and unchanged lines close to changed ones with "  ". Other unchanged
+// lines are collapsed into "...". It returns the empty string if a and b are
+// equal.
+func lineDiff(a, b string) string {
+	as, bs := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:]
+	// and bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	changed := false
+	for i, j := 0, 0; i < len(as) || j < len(bs); {
+		switch {
+		case i < len(as) && j < len(bs) && as[i] == bs[j]:
+			lines = append(lines, "  "+as[i])
+			i++
+			j++
+		case j == len(bs) || (i < len(as) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+as[i])
+			changed = true
+			i++
+		default:
+			lines = append(lines, "+ "+bs[j])
+			changed = true
+			j++
+		}
+	}
+	if !changed {
+		return ""
+	}
+	// Only show unchanged lines within diffContext of a changed one.
+	show := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  ") {
+			continue
+		}
+		for k := i - diffContext; k <= i+diffContext; k++ {
+			if k >= 0 && k < len(lines) {
+				show[k] = true
+			}
+		}
+	}
+	var res strings.Builder
+	skipped := false
+	for i, l := range lines {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			res.WriteString("  ...\n")
+			skipped = false
+		}
+		res.WriteString(l + "\n")
+	}
+	if skipped {
+		res.WriteString("  ...\n")
+	}
+	return res.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Preview returns the ChartAssignments that the controller generates for the
+// AppRollout, which doesn't need to exist yet, and how they differ from the
+// current ones. The base values are the ones passed to the controller.
+//
+// The preview shows the ChartAssignments once the rollout is complete.
+// Rollout strategies, failure policies, and update policies may defer
+// individual updates.
+func Preview(ctx context.Context, kube kclient.Client, ar *apps.AppRollout, baseValues chartutil.Values) ([]PreviewEntry, error) {
+	if err := validate(ar); err != nil {
+		return nil, errors.Wrap(err, "invalid AppRollout")
+	}
+	r := &Reconciler{kube: kube, baseValues: baseValues}
+
+	var app apps.App
+	if err := kube.Get(ctx, kclient.ObjectKey{Name: ar.Spec.AppName}, &app); err != nil {
+		return nil, errors.Wrapf(err, "get App %q", ar.Spec.AppName)
+	}
+	robots, err := r.listRobots(ctx, &ar.Spec)
+	if err != nil {
+		return nil, err
+	}
+	wantCAs, err := r.wantChartAssignments(ctx, &app, ar, robots)
+	if err != nil {
+		return nil, err
+	}
+	// The field index on owner references only exists in the controller's
+	// cache, so we filter all ChartAssignments here.
+	var cas apps.ChartAssignmentList
+	if err := kube.List(ctx, &cas); err != nil {
+		return nil, errors.Wrap(err, "list ChartAssignments")
+	}
+	curCAs := map[string]*apps.ChartAssignment{}
+	for i := range cas.Items {
+		if ownedByRollout(&cas.Items[i], ar.Name) {
+			curCAs[cas.Items[i].Name] = &cas.Items[i]
+		}
+	}
+	return previewEntries(curCAs, wantCAs)
+}
+
+// ownedByRollout returns whether the ChartAssignment is controlled by the
+// AppRollout with the given name.
+func ownedByRollout(ca *apps.ChartAssignment, name string) bool {
+	for _, or := range ca.OwnerReferences {
+		if or.Kind == "AppRollout" && or.Name == name && or.Controller != nil && *or.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+// previewEntries compares the current and wanted ChartAssignments and
+// returns the entries sorted by name.
+func previewEntries(curCAs map[string]*apps.ChartAssignment, wantCAs []*apps.ChartAssignment) ([]PreviewEntry, error) {
+	var entries []PreviewEntry
+	seen := map[string]bool{}
+
+	for _, want := range wantCAs {
+		seen[want.Name] = true
+		cur, ok := curCAs[want.Name]
+		if !ok {
+			entries = append(entries, PreviewEntry{Action: PreviewCreate, Want: want})
+			continue
+		}
+		action := PreviewUnchanged
+		if changed, err := chartAssignmentChanged(cur, want); err != nil {
+			return nil, errors.Wrap(err, "check ChartAssignment changed")
+		} else if changed {
+			action = PreviewUpdate
+		}
+		entries = append(entries, PreviewEntry{Action: action, Current: cur, Want: want})
+	}
+	for name, cur := range curCAs {
+		if !seen[name] {
+			entries = append(entries, PreviewEntry{Action: PreviewDelete, Current: cur})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+)
+
+func TestPreviewEntries(t *testing.T) {
+	newCA := func(name, values string) *apps.ChartAssignment {
+		var ca apps.ChartAssignment
+		unmarshalYAML(t, &ca, `
+metadata:
+  name: `+name+`
+spec:
+  clusterName: `+name+`
+  chart:
+    inline: abc
+    values: `+values+`
+`)
+		return &ca
+	}
+	curCAs := map[string]*apps.ChartAssignment{
+		"a": newCA("a", "{foo: 1}"),
+		"b": newCA("b", "{foo: 1}"),
+		"c": newCA("c", "{foo: 1}"),
+	}
+	wantCAs := []*apps.ChartAssignment{
+		newCA("d", "{foo: 1}"),
+		newCA("b", "{foo: 2}"),
+		newCA("a", "{foo: 1}"),
+	}
+	entries, err := previewEntries(curCAs, wantCAs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name()+":"+string(e.Action))
+	}
+	want := []string{"a:unchanged", "b:update", "c:delete", "d:create"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got entries %v, want %v", got, want)
+	}
+
+	if diff, err := entries[0].Diff(); err != nil {
+		t.Fatal(err)
+	} else if diff != "" {
+		t.Errorf("unchanged entry has diff:\n%s", diff)
+	}
+	diff, err := entries[1].Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"\n-       foo: 1\n", "\n+       foo: 2\n"} {
+		if !strings.Contains(diff, s) {
+			t.Errorf("diff of updated entry doesn't contain %q:\n%s", s, diff)
+		}
+	}
+	if entries[2].ClusterName() != "c" || entries[3].ClusterName() != "d" {
+		t.Errorf("unexpected cluster names %q, %q", entries[2].ClusterName(), entries[3].ClusterName())
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	b := "a\nb\nc\nd\ne\nF\ng\nh\ni\nj\n"
+	want := `  ...
+  c
+  d
+  e
+- f
++ F
+  g
+  h
+  i
++ j
+`
+	if got := lineDiff(a, b); got != want {
+		t.Errorf("want diff\n%s\ngot\n%s", want, got)
+	}
+	if got := lineDiff(a, a); got != "" {
+		t.Errorf("want no diff for equal input, got\n%s", got)
+	}
+	if got, want := lineDiff("", "a\n"), "+ a\n"; got != want {
+		t.Errorf("want diff %q for added input, got %q", want, got)
+	}
+}
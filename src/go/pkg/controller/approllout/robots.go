@@ -0,0 +1,290 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	fieldIndexSelectorKeys = "spec.robots.selector.keys"
+
+	// selectorKeyAll is indexed for selectors that may match robots
+	// regardless of their labels, e.g. "any: true" or "DoesNotExist".
+	selectorKeyAll = "*"
+
+	// robotBatchPeriod is how long rollouts wait after a robot change
+	// before they are reconciled. Changes to many robots, e.g. when a fleet
+	// is registered, are handled with a single reconcile per rollout.
+	robotBatchPeriod = time.Second
+
+	// robotNamespace is the namespace in which Robots are registered.
+	robotNamespace = "default"
+)
+
+// rolloutSpecs returns the specs whose robot selectors determine the
+// robots of a rollout. Besides the current spec, this is the last Ready
+// spec that a halted rollout may roll back to.
+func rolloutSpecs(ar *apps.AppRollout) []*apps.AppRolloutSpec {
+	specs := []*apps.AppRolloutSpec{&ar.Spec}
+	if ar.Status.LastReady != nil {
+		specs = append(specs, &ar.Status.LastReady.Spec)
+	}
+	return specs
+}
+
+// selectsAll returns whether the selector may match robots without any
+// of the label keys it references.
+func selectsAll(sel *apps.RobotSelector) bool {
+	if sel.Any != nil && *sel.Any {
+		return true
+	}
+	if sel.LabelSelector == nil {
+		return false
+	}
+	if len(sel.MatchLabels) == 0 && len(sel.MatchExpressions) == 0 {
+		return true
+	}
+	for _, e := range sel.MatchExpressions {
+		if e.Operator == metav1.LabelSelectorOpNotIn || e.Operator == metav1.LabelSelectorOpDoesNotExist {
+			return true
+		}
+	}
+	return false
+}
+
+// indexSelectorKeys indexes AppRollouts by the label keys their robot
+// selectors reference. Selectors that may match robots without these keys
+// are indexed as selectorKeyAll.
+func indexSelectorKeys(o runtime.Object) []string {
+	ar := o.(*apps.AppRollout)
+	keys := map[string]bool{}
+
+	for _, spec := range rolloutSpecs(ar) {
+		for _, r := range spec.Robots {
+			sel := r.Selector
+			if sel == nil {
+				continue
+			}
+			if selectsAll(sel) {
+				keys[selectorKeyAll] = true
+				continue
+			}
+			if sel.LabelSelector == nil {
+				continue
+			}
+			for k := range sel.MatchLabels {
+				keys[k] = true
+			}
+			for _, e := range sel.MatchExpressions {
+				keys[e.Key] = true
+			}
+		}
+	}
+	vs := make([]string, 0, len(keys))
+	for k := range keys {
+		vs = append(vs, k)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// selectsRobotLabels returns whether any robot selector of the rollout
+// matches the given robot labels.
+func selectsRobotLabels(ar *apps.AppRollout, set labels.Set) bool {
+	for _, spec := range rolloutSpecs(ar) {
+		for _, r := range spec.Robots {
+			sel := r.Selector
+			if sel == nil {
+				continue
+			}
+			if sel.Any != nil && *sel.Any {
+				return true
+			}
+			if sel.LabelSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(sel.LabelSelector)
+			if err != nil {
+				// Invalid selectors are reported when the rollout is reconciled.
+				return true
+			}
+			if selector.Matches(set) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enqueueForRobot enqueues all AppRollouts whose robot selectors match the
+// labels of any of the given robot objects, e.g. the old and new version of
+// an updated robot. The requests are delayed by the given duration, which
+// merges the requests for changes of many robots.
+func (r *Reconciler) enqueueForRobot(q workqueue.RateLimitingInterface, delay time.Duration, robots ...metav1.Object) {
+	keys := map[string]bool{selectorKeyAll: true}
+	for _, m := range robots {
+		for k := range m.GetLabels() {
+			keys[k] = true
+		}
+	}
+	candidates := map[string]*apps.AppRollout{}
+
+	for k := range keys {
+		var rollouts apps.AppRolloutList
+		err := r.kube.List(context.TODO(), &rollouts, kclient.MatchingField(fieldIndexSelectorKeys, k))
+		if err != nil {
+			log.Printf("List AppRollouts for selector key %s failed: %s", k, err)
+			continue
+		}
+		for i := range rollouts.Items {
+			candidates[rollouts.Items[i].Name] = &rollouts.Items[i]
+		}
+	}
+	for name, ar := range candidates {
+		for _, m := range robots {
+			if selectsRobotLabels(ar, labels.Set(m.GetLabels())) {
+				q.AddAfter(reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: name},
+				}, delay)
+				break
+			}
+		}
+	}
+}
+
+// keepDeletedRobots keeps the ChartAssignments of robots that were deleted
+// less than the grace period ago, as robots briefly disappear at times
+// (b/125308238). It removes them from dropCAs and records when the robots
+// were found to be deleted in the rollout's status. requeueAfter is the time
+// until the next grace period ends.
+func (r *Reconciler) keepDeletedRobots(ctx context.Context, ar *apps.AppRollout, dropCAs map[string]apps.ChartAssignment, now time.Time) (requeueAfter time.Duration, err error) {
+	deletedSince := map[string]metav1.Time{}
+	for _, d := range ar.Status.DeletedRobots {
+		deletedSince[d.Name] = d.DeletionTime
+	}
+	ar.Status.DeletedRobots = nil
+
+	if r.robotDeletionGracePeriod <= 0 {
+		return 0, nil
+	}
+	var dropRobots []string
+	for _, ca := range dropCAs {
+		if ca.Spec.ClusterName != "cloud" {
+			dropRobots = append(dropRobots, ca.Spec.ClusterName)
+		}
+	}
+	if len(dropRobots) == 0 {
+		return 0, nil
+	}
+	sort.Strings(dropRobots)
+	for _, name := range dropRobots {
+		// Robots that still exist but are no longer selected lose their
+		// ChartAssignments right away.
+		var robot registry.Robot
+		err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: robotNamespace, Name: name}, &robot)
+		if err == nil {
+			continue
+		} else if !k8serrors.IsNotFound(err) {
+			return 0, errors.Wrapf(err, "get Robot %q", name)
+		}
+		since, ok := deletedSince[name]
+		if !ok {
+			since = metav1.NewTime(now)
+		}
+		wait := since.Add(r.robotDeletionGracePeriod).Sub(now)
+		if wait <= 0 {
+			continue
+		}
+		for caName, ca := range dropCAs {
+			if ca.Spec.ClusterName == name {
+				delete(dropCAs, caName)
+			}
+		}
+		ar.Status.DeletedRobots = append(ar.Status.DeletedRobots, apps.AppRolloutDeletedRobot{
+			Name:         name,
+			DeletionTime: since,
+		})
+		if requeueAfter == 0 || wait < requeueAfter {
+			requeueAfter = wait
+		}
+	}
+	return requeueAfter, nil
+}
+
+// listRobots returns the robots that are matched by the robot selectors
+// of the given specs. Label selectors are passed on to the list calls, which
+// are served from the cache. Selectors with "any: true" cannot be narrowed
+// down this way and list all Robots.
+func (r *Reconciler) listRobots(ctx context.Context, specs ...*apps.AppRolloutSpec) ([]registry.Robot, error) {
+	var selectors []labels.Selector
+
+	for _, spec := range specs {
+		for _, e := range spec.Robots {
+			sel := e.Selector
+			if sel == nil {
+				continue
+			}
+			if sel.Any != nil && *sel.Any {
+				var robots registry.RobotList
+				if err := r.kube.List(ctx, &robots); err != nil {
+					return nil, errors.Wrap(err, "list all Robots")
+				}
+				return robots.Items, nil
+			}
+			if sel.LabelSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(sel.LabelSelector)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid robot selector")
+			}
+			selectors = append(selectors, selector)
+		}
+	}
+	var (
+		res  []registry.Robot
+		seen = map[string]bool{}
+	)
+	for _, selector := range selectors {
+		var robots registry.RobotList
+		err := r.kube.List(ctx, &robots, kclient.MatchingLabelsSelector{Selector: selector})
+		if err != nil {
+			return nil, errors.Wrapf(err, "list Robots for selector %q", selector)
+		}
+		for _, rb := range robots.Items {
+			if !seen[rb.Name] {
+				seen[rb.Name] = true
+				res = append(res, rb)
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestIndexSelectorKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{
+			name: "match-labels",
+			spec: `
+robots:
+- selector:
+    matchLabels: {site: munich, type: mir}
+- selector:
+    matchExpressions:
+    - {key: model, operator: In, values: [a]}
+`,
+			want: []string{"model", "site", "type"},
+		},
+		{
+			name: "any",
+			spec: `
+robots:
+- selector:
+    any: true
+`,
+			want: []string{"*"},
+		},
+		{
+			name: "does-not-exist",
+			spec: `
+robots:
+- selector:
+    matchExpressions:
+    - {key: a, operator: DoesNotExist}
+- selector:
+    matchLabels: {b: c}
+`,
+			want: []string{"*", "b"},
+		},
+		{
+			name: "no-robots",
+			spec: `
+cloud: {}
+`,
+			want: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var ar apps.AppRollout
+			unmarshalYAML(t, &ar.Spec, c.spec)
+
+			if got := indexSelectorKeys(&ar); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestIndexSelectorKeys_lastReady(t *testing.T) {
+	var ar apps.AppRollout
+	unmarshalYAML(t, &ar, `
+spec:
+  robots:
+  - selector:
+      matchLabels: {site: munich}
+status:
+  lastReady:
+    generation: 1
+    spec:
+      robots:
+      - selector:
+          matchLabels: {site: berlin, model: b}
+`)
+	want := []string{"model", "site"}
+	if got := indexSelectorKeys(&ar); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSelectsRobotLabels(t *testing.T) {
+	var ar apps.AppRollout
+	unmarshalYAML(t, &ar, `
+spec:
+  robots:
+  - selector:
+      matchLabels: {site: munich}
+  - selector:
+      matchExpressions:
+      - {key: model, operator: In, values: [a, b]}
+`)
+	cases := []struct {
+		labels labels.Set
+		want   bool
+	}{
+		{labels: labels.Set{"site": "munich"}, want: true},
+		{labels: labels.Set{"site": "berlin"}, want: false},
+		{labels: labels.Set{"site": "berlin", "model": "b"}, want: true},
+		{labels: labels.Set{"model": "c"}, want: false},
+		{labels: nil, want: false},
+	}
+	for _, c := range cases {
+		if got := selectsRobotLabels(&ar, c.labels); got != c.want {
+			t.Errorf("selectsRobotLabels(%v): got %v, want %v", c.labels, got, c.want)
+		}
+	}
+}
+
+func TestKeepDeletedRobots(t *testing.T) {
+	// robot1 was deleted, robot2 still exists but is no longer selected.
+	robot2 := &registry.Robot{ObjectMeta: metav1.ObjectMeta{Name: "robot2", Namespace: "default"}}
+	r := &Reconciler{
+		kube:                     newFakeClient(t, robot2),
+		robotDeletionGracePeriod: time.Minute,
+	}
+	dropped := func() map[string]apps.ChartAssignment {
+		dropCAs := map[string]apps.ChartAssignment{}
+		for _, ca := range newStrategyTestCAs(2, "1") {
+			dropCAs[ca.Name] = *ca
+		}
+		return dropCAs
+	}
+	ctx := context.Background()
+	ar := &apps.AppRollout{}
+	now := time.Now()
+
+	dropCAs := dropped()
+	requeueAfter, err := r.keepDeletedRobots(ctx, ar, dropCAs, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := dropCAs["foo-robot-robot1"]; ok {
+		t.Error("expected ChartAssignment of deleted robot to be kept")
+	}
+	if _, ok := dropCAs["foo-robot-robot2"]; !ok {
+		t.Error("expected ChartAssignment of deselected robot to be deleted")
+	}
+	if requeueAfter != time.Minute {
+		t.Errorf("want requeue after 1m, got %s", requeueAfter)
+	}
+	want := []apps.AppRolloutDeletedRobot{{Name: "robot1", DeletionTime: metav1.NewTime(now)}}
+	if !reflect.DeepEqual(ar.Status.DeletedRobots, want) {
+		t.Errorf("want deleted robots %v, got %v", want, ar.Status.DeletedRobots)
+	}
+
+	// The deletion time is kept until the grace period ends.
+	dropCAs = dropped()
+	requeueAfter, _ = r.keepDeletedRobots(ctx, ar, dropCAs, now.Add(40*time.Second))
+	if _, ok := dropCAs["foo-robot-robot1"]; ok || requeueAfter != 20*time.Second {
+		t.Errorf("expected ChartAssignment to be kept for another 20s, got requeue after %s", requeueAfter)
+	}
+
+	dropCAs = dropped()
+	requeueAfter, _ = r.keepDeletedRobots(ctx, ar, dropCAs, now.Add(time.Minute))
+	if _, ok := dropCAs["foo-robot-robot1"]; !ok {
+		t.Error("expected ChartAssignment of deleted robot to be deleted after the grace period")
+	}
+	if requeueAfter != 0 || len(ar.Status.DeletedRobots) != 0 {
+		t.Errorf("expected no deleted robots to be left, got %v and requeue after %s", ar.Status.DeletedRobots, requeueAfter)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+)
+
+// scheduledIn returns the time until the activation time of the rollout's
+// schedule, or zero if the spec is to be applied now.
+func scheduledIn(ar *apps.AppRollout, now time.Time) time.Duration {
+	if ar.Spec.Schedule == nil {
+		return 0
+	}
+	if wait := ar.Spec.Schedule.ActivationTime.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScheduledIn(t *testing.T) {
+	now := time.Date(2020, 6, 13, 10, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		schedule *apps.AppRolloutSchedule
+		want     time.Duration
+	}{
+		{name: "no-schedule", schedule: nil, want: 0},
+		{
+			name:     "future",
+			schedule: &apps.AppRolloutSchedule{ActivationTime: metav1.NewTime(now.Add(90 * time.Minute))},
+			want:     90 * time.Minute,
+		},
+		{
+			name:     "past",
+			schedule: &apps.AppRolloutSchedule{ActivationTime: metav1.NewTime(now.Add(-time.Minute))},
+			want:     0,
+		},
+		{
+			name:     "now",
+			schedule: &apps.AppRolloutSchedule{ActivationTime: metav1.NewTime(now)},
+			want:     0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ar := &apps.AppRollout{Spec: apps.AppRolloutSpec{Schedule: c.schedule}}
+			if got := scheduledIn(ar, now); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
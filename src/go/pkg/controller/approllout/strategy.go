@@ -0,0 +1,320 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const defaultBatchDeadline = 10 * time.Minute
+
+// planRollout advances the batched rollout of the robot ChartAssignments if
+// the rollout has a strategy. It updates the rollout's progress and returns
+// the names of the wanted ChartAssignments that must be left untouched as they
+// wait for a later batch. Gated ChartAssignments, whose update policy doesn't
+// allow an update right now, are always left untouched and aren't chosen for
+// a batch, so that they don't hold up the rollout. While a batch is in
+// progress, requeueAfter is the time until its deadline.
+func planRollout(
+	ar *apps.AppRollout,
+	wantCAs []*apps.ChartAssignment,
+	curCAs map[string]apps.ChartAssignment,
+	gated map[string]bool,
+	now time.Time,
+) (skip map[string]bool, requeueAfter time.Duration, err error) {
+	skip = map[string]bool{}
+	for name := range gated {
+		skip[name] = true
+	}
+	strategy := ar.Spec.Strategy
+	if strategy == nil {
+		ar.Status.Rollout = nil
+		return skip, 0, nil
+	}
+	p := ar.Status.Rollout
+	if p == nil || p.Generation != ar.Generation {
+		p = &apps.AppRolloutProgress{Generation: ar.Generation}
+		ar.Status.Rollout = p
+	}
+	// Robots whose ChartAssignments don't match the wanted ones, in the
+	// order in which they are rolled out. Only the ones that aren't gated
+	// can be chosen for the next batch.
+	var (
+		pending, eligible []string
+		robots            = map[string]*apps.ChartAssignment{}
+	)
+	for _, ca := range wantCAs {
+		if ca.Spec.ClusterName == "cloud" {
+			continue
+		}
+		robots[ca.Spec.ClusterName] = ca
+		cur, ok := curCAs[ca.Name]
+		if !ok {
+			pending = append(pending, ca.Spec.ClusterName)
+		} else if changed, err := chartAssignmentChanged(&cur, ca); err != nil {
+			return nil, 0, errors.Wrap(err, "check ChartAssignment changed")
+		} else if changed {
+			pending = append(pending, ca.Spec.ClusterName)
+		}
+	}
+	sort.Strings(pending)
+	for _, r := range pending {
+		if !gated[robots[r].Name] {
+			eligible = append(eligible, r)
+		}
+	}
+
+	// The ChartAssignments of the current batch are always applied, so
+	// that they are retried and cleaned up from robots that disappeared.
+	var batch []string
+	// Robots of the batch that became gated before they were updated are
+	// returned to the pending ones.
+	for _, r := range p.Robots {
+		if ca, ok := robots[r]; ok && !gated[ca.Name] {
+			batch = append(batch, r)
+		}
+	}
+	p.Robots = batch
+
+	deadline := defaultBatchDeadline
+	if strategy.DeadlineSeconds > 0 {
+		deadline = time.Duration(strategy.DeadlineSeconds) * time.Second
+	}
+	switch {
+	case !batchReady(batch, robots, curCAs):
+		if elapsed := now.Sub(p.BatchStartTime.Time); elapsed >= deadline {
+			haltRollout(ar, fmt.Sprintf("batch %d not ready after %s", p.Batch, deadline))
+		} else {
+			requeueAfter = deadline - elapsed
+			setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionTrue,
+				fmt.Sprintf("waiting for batch %d to become ready", p.Batch))
+		}
+	case len(pending) == 0:
+		p.Robots = nil
+		setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionFalse, "rollout complete")
+	case len(eligible) == 0:
+		p.Robots = nil
+		setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionTrue,
+			fmt.Sprintf("waiting for the update policies of %d robots", len(pending)))
+	default:
+		size := strategy.BatchSize
+		if p.Batch == 0 && strategy.Canary != nil {
+			size = strategy.Canary
+		}
+		n, err := batchSize(size, len(robots))
+		if err != nil {
+			return nil, 0, err
+		}
+		if n > len(eligible) {
+			n = len(eligible)
+		}
+		p.Batch++
+		p.Robots = eligible[:n]
+		p.BatchStartTime = metav1.NewTime(now)
+		requeueAfter = deadline
+		setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionTrue,
+			fmt.Sprintf("rolling out batch %d to %d robots", p.Batch, n))
+	}
+
+	for _, r := range pending {
+		if !stringsContain(p.Robots, r) {
+			skip[robots[r].Name] = true
+		}
+	}
+	p.PendingRobots = int64(len(skip))
+	p.UpdatedRobots = int64(len(robots) - len(pending))
+	return skip, requeueAfter, nil
+}
+
+// haltRollout halts the rollout of the current generation for the given
+// reason.
+func haltRollout(ar *apps.AppRollout, reason string) {
+	ar.Status.HaltedGeneration = ar.Generation
+	if rollsBack(ar) {
+		reason = fmt.Sprintf("%s, rolling back to generation %d", reason, ar.Status.LastReady.Generation)
+	}
+	log.Printf("Halting AppRollout %q: %s", ar.Name, reason)
+	setCondition(ar, apps.AppRolloutConditionHalted, core.ConditionTrue, reason)
+	setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionFalse, "rollout halted")
+}
+
+// rollsBack returns true if the halted rollout returns to the last Ready
+// spec.
+func rollsBack(ar *apps.AppRollout) bool {
+	p, last := ar.Spec.FailurePolicy, ar.Status.LastReady
+	return p != nil && p.Rollback && last != nil && last.Generation != ar.Generation
+}
+
+// batchReady returns true if the ChartAssignments of all robots in the batch
+// are up to date and Ready.
+func batchReady(batch []string, robots map[string]*apps.ChartAssignment, curCAs map[string]apps.ChartAssignment) bool {
+	for _, r := range batch {
+		if !upToDate(robots[r], curCAs) || !ready(curCAs[robots[r].Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// allReady returns true if all wanted ChartAssignments are up to date and
+// Ready.
+func allReady(wantCAs []*apps.ChartAssignment, curCAs map[string]apps.ChartAssignment) bool {
+	for _, ca := range wantCAs {
+		if !upToDate(ca, curCAs) || !ready(curCAs[ca.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// upToDate returns true if the ChartAssignment exists and matches the
+// wanted one.
+func upToDate(want *apps.ChartAssignment, curCAs map[string]apps.ChartAssignment) bool {
+	cur, ok := curCAs[want.Name]
+	if !ok {
+		return false
+	}
+	changed, err := chartAssignmentChanged(&cur, want)
+	return err == nil && !changed
+}
+
+func ready(ca apps.ChartAssignment) bool {
+	return ca.Status.Phase == apps.ChartAssignmentPhaseReady && ca.Status.ObservedGeneration == ca.Generation
+}
+
+// failed returns true if the current generation of the ChartAssignment
+// failed to apply or was rolled back.
+func failed(ca apps.ChartAssignment) bool {
+	if rb := ca.Status.Rollback; rb != nil && rb.FailedGeneration == ca.Generation {
+		return true
+	}
+	return ca.Status.Phase == apps.ChartAssignmentPhaseFailed && ca.Status.ObservedGeneration == ca.Generation
+}
+
+// checkFailurePolicy returns a reason to halt the rollout if more robots
+// with up-to-date ChartAssignments failed than the policy allows.
+func checkFailurePolicy(policy *apps.AppRolloutFailurePolicy, wantCAs []*apps.ChartAssignment, curCAs map[string]apps.ChartAssignment) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	var numFailed, total int
+	for _, ca := range wantCAs {
+		if ca.Spec.ClusterName == "cloud" {
+			continue
+		}
+		total++
+		if upToDate(ca, curCAs) && failed(curCAs[ca.Name]) {
+			numFailed++
+		}
+	}
+	maxFailed := 0
+	if policy.MaxFailed != nil {
+		n, err := intstr.GetValueFromIntOrPercent(policy.MaxFailed, total, false)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid maxFailed")
+		}
+		maxFailed = n
+	}
+	if numFailed <= maxFailed {
+		return "", nil
+	}
+	return fmt.Sprintf("%d/%d robots failed, at most %d allowed", numFailed, total, maxFailed), nil
+}
+
+// validateMaxFailed checks that maxFailed is a non-negative number or a
+// percentage between 0% and 100%.
+func validateMaxFailed(max *intstr.IntOrString) error {
+	if max == nil {
+		return nil
+	}
+	if max.Type == intstr.Int {
+		if max.IntVal < 0 {
+			return errors.Errorf("must not be negative, got %d", max.IntVal)
+		}
+		return nil
+	}
+	if !strings.HasSuffix(max.StrVal, "%") {
+		return errors.Errorf("invalid percentage %q", max.StrVal)
+	}
+	n, err := intstr.GetValueFromIntOrPercent(max, 100, false)
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > 100 {
+		return errors.Errorf("must be between 0%% and 100%%, got %s", max.StrVal)
+	}
+	return nil
+}
+
+// batchSize returns the number of robots in a batch of the given size. A
+// percentage of the total number of robots is rounded up. Batches contain at
+// least one robot and default to all robots.
+func batchSize(size *intstr.IntOrString, total int) (int, error) {
+	if size == nil {
+		return total, nil
+	}
+	n, err := intstr.GetValueFromIntOrPercent(size, total, true)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid batch size")
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n, nil
+}
+
+// validateBatchSize checks that the size is a positive number or a
+// percentage between 1% and 100%.
+func validateBatchSize(size *intstr.IntOrString) error {
+	if size == nil {
+		return nil
+	}
+	if size.Type == intstr.Int {
+		if size.IntVal < 1 {
+			return errors.Errorf("must be positive, got %d", size.IntVal)
+		}
+		return nil
+	}
+	if !strings.HasSuffix(size.StrVal, "%") {
+		return errors.Errorf("invalid percentage %q", size.StrVal)
+	}
+	n, err := intstr.GetValueFromIntOrPercent(size, 100, true)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > 100 {
+		return errors.Errorf("must be between 1%% and 100%%, got %s", size.StrVal)
+	}
+	return nil
+}
+
+func stringsContain(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newStrategyTestCAs returns the wanted ChartAssignments for a cloud and n
+// robots with the given version.
+func newStrategyTestCAs(n int, version string) []*apps.ChartAssignment {
+	cas := []*apps.ChartAssignment{{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-cloud"},
+		Spec: apps.ChartAssignmentSpec{
+			ClusterName: "cloud",
+			Chart:       apps.AssignedChart{Version: version},
+		},
+	}}
+	for i := 1; i <= n; i++ {
+		robot := fmt.Sprintf("robot%d", i)
+		cas = append(cas, &apps.ChartAssignment{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-robot-" + robot},
+			Spec: apps.ChartAssignmentSpec{
+				ClusterName: robot,
+				Chart:       apps.AssignedChart{Version: version},
+			},
+		})
+	}
+	return cas
+}
+
+// applyCAs simulates applying the ChartAssignments that are not skipped and
+// them becoming Ready if ready is true.
+func applyCAs(cur map[string]apps.ChartAssignment, want []*apps.ChartAssignment, skip map[string]bool, ready bool) {
+	for _, ca := range want {
+		if skip[ca.Name] {
+			continue
+		}
+		c := *ca.DeepCopy()
+		c.Generation = cur[ca.Name].Generation + 1
+		if ready {
+			c.Status.ObservedGeneration = c.Generation
+			c.Status.Phase = apps.ChartAssignmentPhaseReady
+		}
+		cur[ca.Name] = c
+	}
+}
+
+func skipped(skip map[string]bool) []string {
+	var res []string
+	for name := range skip {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestPlanRollout_rollsOutInBatches(t *testing.T) {
+	canary, batch := intstr.FromInt(1), intstr.FromString("50%")
+	ar := &apps.AppRollout{}
+	ar.Generation = 2
+	ar.Spec.Strategy = &apps.AppRolloutStrategy{Canary: &canary, BatchSize: &batch}
+
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(4, "1"), nil, true)
+	want := newStrategyTestCAs(4, "2")
+	now := time.Now()
+
+	// Each step advances the rollout after the previous batch became Ready.
+	steps := []struct {
+		batch   int32
+		robots  []string
+		skipped []string
+	}{
+		{1, []string{"robot1"}, []string{"foo-robot-robot2", "foo-robot-robot3", "foo-robot-robot4"}},
+		{2, []string{"robot2", "robot3"}, []string{"foo-robot-robot4"}},
+		{3, []string{"robot4"}, nil},
+	}
+	for _, s := range steps {
+		skip, requeueAfter, err := planRollout(ar, want, cur, nil, now)
+		if err != nil {
+			t.Fatalf("batch %d: unexpected error: %s", s.batch, err)
+		}
+		p := ar.Status.Rollout
+		if p.Batch != s.batch || !reflect.DeepEqual(p.Robots, s.robots) {
+			t.Errorf("want batch %d with %v, got batch %d with %v", s.batch, s.robots, p.Batch, p.Robots)
+		}
+		if got := skipped(skip); !reflect.DeepEqual(got, s.skipped) {
+			t.Errorf("batch %d: want skipped %v, got %v", s.batch, s.skipped, got)
+		}
+		if requeueAfter != defaultBatchDeadline {
+			t.Errorf("batch %d: want requeue after %s, got %s", s.batch, defaultBatchDeadline, requeueAfter)
+		}
+		// While the batch is not Ready, no further robots are updated.
+		applyCAs(cur, want, skip, false)
+		if skip2, _, _ := planRollout(ar, want, cur, nil, now.Add(time.Minute)); !reflect.DeepEqual(skip, skip2) {
+			t.Errorf("batch %d: want skipped %v while in progress, got %v", s.batch, skipped(skip), skipped(skip2))
+		}
+		applyCAs(cur, want, skip, true)
+	}
+	skip, _, err := planRollout(ar, want, cur, nil, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p := ar.Status.Rollout; len(skip) != 0 || p.UpdatedRobots != 4 || p.PendingRobots != 0 || p.Robots != nil {
+		t.Errorf("expected completed rollout, got %+v", p)
+	}
+}
+
+func TestPlanRollout_haltsAfterDeadline(t *testing.T) {
+	canary := intstr.FromInt(1)
+	ar := &apps.AppRollout{}
+	ar.Generation = 2
+	ar.Spec.Strategy = &apps.AppRolloutStrategy{Canary: &canary, DeadlineSeconds: 60}
+
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(3, "1"), nil, true)
+	want := newStrategyTestCAs(3, "2")
+	now := time.Now()
+
+	skip, _, err := planRollout(ar, want, cur, nil, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	applyCAs(cur, want, skip, false)
+
+	_, requeueAfter, _ := planRollout(ar, want, cur, nil, now.Add(20*time.Second))
+	if requeueAfter != 40*time.Second {
+		t.Errorf("want requeue after 40s, got %s", requeueAfter)
+	}
+	skip, _, _ = planRollout(ar, want, cur, nil, now.Add(time.Minute))
+	if ar.Status.HaltedGeneration != 2 {
+		t.Fatal("expected rollout to be halted")
+	}
+	if got, want := skipped(skip), []string{"foo-robot-robot2", "foo-robot-robot3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want skipped %v, got %v", want, got)
+	}
+	// A new generation restarts the rollout.
+	ar.Generation = 3
+	planRollout(ar, want, cur, nil, now.Add(3*time.Minute))
+	if p := ar.Status.Rollout; p.Batch != 1 || !reflect.DeepEqual(p.Robots, []string{"robot2"}) {
+		t.Errorf("expected restarted rollout, got %+v", p)
+	}
+}
+
+func TestPlanRollout_leavesOutGatedRobots(t *testing.T) {
+	canary, batch := intstr.FromInt(1), intstr.FromString("50%")
+	ar := &apps.AppRollout{}
+	ar.Generation = 2
+	ar.Spec.Strategy = &apps.AppRolloutStrategy{Canary: &canary, BatchSize: &batch, DeadlineSeconds: 60}
+
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(4, "1"), nil, true)
+	want := newStrategyTestCAs(4, "2")
+	gated := map[string]bool{"foo-robot-robot1": true}
+	now := time.Now()
+
+	steps := []struct {
+		batch   int32
+		robots  []string
+		skipped []string
+	}{
+		{1, []string{"robot2"}, []string{"foo-robot-robot1", "foo-robot-robot3", "foo-robot-robot4"}},
+		{2, []string{"robot3", "robot4"}, []string{"foo-robot-robot1"}},
+		// Only the gated robot is left, which doesn't start a batch.
+		{2, nil, []string{"foo-robot-robot1"}},
+	}
+	for _, s := range steps {
+		skip, _, err := planRollout(ar, want, cur, gated, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		p := ar.Status.Rollout
+		if p.Batch != s.batch || !reflect.DeepEqual(p.Robots, s.robots) {
+			t.Errorf("want batch %d with %v, got %d with %v", s.batch, s.robots, p.Batch, p.Robots)
+		}
+		if got := skipped(skip); !reflect.DeepEqual(got, s.skipped) {
+			t.Errorf("batch %d: want skipped %v, got %v", s.batch, s.skipped, got)
+		}
+		applyCAs(cur, want, skip, true)
+	}
+	// Waiting for the gated robot doesn't halt the rollout.
+	planRollout(ar, want, cur, gated, now.Add(time.Hour))
+	if ar.Status.HaltedGeneration != 0 {
+		t.Fatal("expected rollout to not be halted")
+	}
+	// Once its update policy allows it, the robot is updated.
+	skip, _, _ := planRollout(ar, want, cur, nil, now.Add(time.Hour))
+	if p := ar.Status.Rollout; p.Batch != 3 || !reflect.DeepEqual(p.Robots, []string{"robot1"}) || len(skip) != 0 {
+		t.Errorf("expected batch 3 with robot1, got %+v, skipped %v", p, skipped(skip))
+	}
+}
+
+func TestPlanRollout_dropsGatedRobotsFromBatch(t *testing.T) {
+	canary := intstr.FromInt(1)
+	ar := &apps.AppRollout{}
+	ar.Generation = 2
+	ar.Spec.Strategy = &apps.AppRolloutStrategy{Canary: &canary, DeadlineSeconds: 60}
+
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(2, "1"), nil, true)
+	want := newStrategyTestCAs(2, "2")
+	now := time.Now()
+
+	if _, _, err := planRollout(ar, want, cur, nil, now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// The canary robot starts a mission before its ChartAssignment was
+	// updated, so the next robot takes its place.
+	gated := map[string]bool{"foo-robot-robot1": true}
+	skip, _, _ := planRollout(ar, want, cur, gated, now.Add(time.Minute))
+	if ar.Status.HaltedGeneration != 0 {
+		t.Fatal("expected rollout to not be halted")
+	}
+	if p := ar.Status.Rollout; p.Batch != 2 || !reflect.DeepEqual(p.Robots, []string{"robot2"}) {
+		t.Errorf("expected batch 2 with robot2, got %+v", p)
+	}
+	if got, want := skipped(skip), []string{"foo-robot-robot1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want skipped %v, got %v", want, got)
+	}
+}
+
+func TestPlanRollout_noStrategy(t *testing.T) {
+	ar := &apps.AppRollout{}
+	ar.Status.Rollout = &apps.AppRolloutProgress{Batch: 3}
+
+	skip, requeueAfter, err := planRollout(ar, newStrategyTestCAs(3, "2"), nil, nil, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(skip) != 0 || requeueAfter != 0 || ar.Status.Rollout != nil {
+		t.Errorf("expected no rollout plan, got %v, %s, %+v", skip, requeueAfter, ar.Status.Rollout)
+	}
+}
+
+func TestValidateBatchSize(t *testing.T) {
+	for _, s := range []intstr.IntOrString{intstr.FromInt(1), intstr.FromString("1%"), intstr.FromString("100%")} {
+		if err := validateBatchSize(&s); err != nil {
+			t.Errorf("%s: unexpected error: %s", s.String(), err)
+		}
+	}
+	for _, s := range []intstr.IntOrString{intstr.FromInt(0), intstr.FromString("0%"), intstr.FromString("101%"), intstr.FromString("1")} {
+		if err := validateBatchSize(&s); err == nil {
+			t.Errorf("%s: expected error", s.String())
+		}
+	}
+}
+
+func TestCheckFailurePolicy(t *testing.T) {
+	cur := map[string]apps.ChartAssignment{}
+	applyCAs(cur, newStrategyTestCAs(4, "1"), nil, true)
+	want := newStrategyTestCAs(4, "2")
+	applyCAs(cur, want, nil, false)
+
+	// robot1 failed to apply, robot2 was rolled back and robot3 failed on
+	// the previous version, which doesn't count.
+	fail := func(name string, f func(ca *apps.ChartAssignment)) {
+		ca := cur[name]
+		f(&ca)
+		cur[name] = ca
+	}
+	fail("foo-robot-robot1", func(ca *apps.ChartAssignment) {
+		ca.Status.ObservedGeneration = ca.Generation
+		ca.Status.Phase = apps.ChartAssignmentPhaseFailed
+	})
+	fail("foo-robot-robot2", func(ca *apps.ChartAssignment) {
+		ca.Status.Rollback = &apps.ChartAssignmentRollbackStatus{FailedGeneration: ca.Generation}
+	})
+	fail("foo-robot-robot3", func(ca *apps.ChartAssignment) {
+		ca.Spec.Chart.Version = "1"
+		ca.Status.ObservedGeneration = ca.Generation
+		ca.Status.Phase = apps.ChartAssignmentPhaseFailed
+	})
+	two, half, quarter := intstr.FromInt(2), intstr.FromString("50%"), intstr.FromString("25%")
+
+	cases := []struct {
+		name   string
+		policy *apps.AppRolloutFailurePolicy
+		halt   bool
+	}{
+		{"no-policy", nil, false},
+		{"default", &apps.AppRolloutFailurePolicy{}, true},
+		{"max-failed", &apps.AppRolloutFailurePolicy{MaxFailed: &two}, false},
+		{"max-failed-percent", &apps.AppRolloutFailurePolicy{MaxFailed: &half}, false},
+		{"exceeds-max-failed-percent", &apps.AppRolloutFailurePolicy{MaxFailed: &quarter}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reason, err := checkFailurePolicy(c.policy, want, cur)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if halt := reason != ""; halt != c.halt {
+				t.Errorf("want halt %v, got reason %q", c.halt, reason)
+			}
+		})
+	}
+}
+
+func TestHaltRollout(t *testing.T) {
+	ar := &apps.AppRollout{}
+	ar.Generation = 3
+	ar.Spec.FailurePolicy = &apps.AppRolloutFailurePolicy{Rollback: true}
+	ar.Status.LastReady = &apps.AppRolloutLastReady{Generation: 2}
+	setCondition(ar, apps.AppRolloutConditionProgressing, core.ConditionTrue, "rolling out batch 2 to 1 robots")
+
+	haltRollout(ar, "2/4 robots failed")
+
+	if ar.Status.HaltedGeneration != 3 || !rollsBack(ar) {
+		t.Errorf("expected halted rollout that rolls back, got %+v", ar.Status)
+	}
+	c := condition(ar.Status.Conditions, apps.AppRolloutConditionHalted)
+	if want := "2/4 robots failed, rolling back to generation 2"; c == nil || c.Status != core.ConditionTrue || c.Message != want {
+		t.Errorf("want Halted condition %q, got %+v", want, c)
+	}
+	// The rollout stops progressing no matter why it was halted.
+	if c := condition(ar.Status.Conditions, apps.AppRolloutConditionProgressing); c == nil || c.Status != core.ConditionFalse {
+		t.Errorf("want Progressing condition to be false, got %+v", c)
+	}
+	// Without a previous Ready generation, there's nothing to roll back to.
+	ar.Status.LastReady.Generation = 3
+	if rollsBack(ar) {
+		t.Error("expected no rollback to the current generation")
+	}
+}
+
+func TestValidateMaxFailed(t *testing.T) {
+	for _, s := range []intstr.IntOrString{intstr.FromInt(0), intstr.FromString("0%"), intstr.FromString("100%")} {
+		if err := validateMaxFailed(&s); err != nil {
+			t.Errorf("%s: unexpected error: %s", s.String(), err)
+		}
+	}
+	for _, s := range []intstr.IntOrString{intstr.FromInt(-1), intstr.FromString("101%"), intstr.FromString("1")} {
+		if err := validateMaxFailed(&s); err == nil {
+			t.Errorf("%s: expected error", s.String())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/helm/pkg/chartutil"
+)
+
+// robotAnnotationPrefix marks the Robot annotations that are passed to the
+// charts, with the prefix removed. Other annotations are left out, as they
+// may be written by any tool and would cause needless updates of the
+// ChartAssignments.
+const robotAnnotationPrefix = "values.cloudrobotics.com/"
+
+// robotValues is the struct that is passed into the chart configuration
+// for each robot matched by a rollout.
+type robotValues struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type,omitempty"`
+	Project     string            `json:"project,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func newRobotValues(r *registry.Robot) robotValues {
+	v := robotValues{
+		Name:    r.Name,
+		Type:    r.Spec.Type,
+		Project: r.Spec.Project,
+	}
+	for k, l := range r.Labels {
+		if v.Labels == nil {
+			v.Labels = map[string]string{}
+		}
+		v.Labels[k] = l
+	}
+	for k, a := range r.Annotations {
+		if !strings.HasPrefix(k, robotAnnotationPrefix) {
+			continue
+		}
+		if v.Annotations == nil {
+			v.Annotations = map[string]string{}
+		}
+		v.Annotations[strings.TrimPrefix(k, robotAnnotationPrefix)] = a
+	}
+	return v
+}
+
+// cloudRobotValues is the entry of the robots list that is passed into the
+// cloud chart. Besides the robot's metadata it holds the values of the
+// robots entry that selected the robot, rendered for that robot.
+type cloudRobotValues struct {
+	robotValues
+	Values apps.ConfigValues `json:"values,omitempty"`
+}
+
+func newCloudRobotValues(r *registry.Robot, spec *apps.AppRolloutSpecRobot) (cloudRobotValues, error) {
+	v := cloudRobotValues{robotValues: newRobotValues(r)}
+	vals, err := robotSpecValues(spec, v.robotValues)
+	if err != nil {
+		return v, errRenderValues{robot: r.Name, err: err}
+	}
+	if len(vals) > 0 {
+		v.Values = vals
+	}
+	return v, nil
+}
+
+// robotValuesChanged returns whether a robot update changed the values
+// passed to the charts.
+func robotValuesChanged(old, new runtime.Object) bool {
+	o, ok := old.(*registry.Robot)
+	if !ok {
+		return true
+	}
+	n, ok := new.(*registry.Robot)
+	if !ok {
+		return true
+	}
+	return !reflect.DeepEqual(newRobotValues(o), newRobotValues(n))
+}
+
+// jsonValue returns the generic form of v's JSON encoding. Unlike structs,
+// it can be held and deep-copied by ConfigValues.
+func jsonValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// robotSpecValues returns the values of a robots entry for the given robot.
+// Values are passed on as they are, so that they can hold templates for the
+// chart, such as Prometheus alerts. Only the strings in valuesTemplate are
+// rendered with the robot's values, and they override the values.
+func robotSpecValues(spec *apps.AppRolloutSpecRobot, robot robotValues) (apps.ConfigValues, error) {
+	vals := chartutil.Values(spec.Values.DeepCopy())
+	if len(spec.ValuesTemplate) == 0 {
+		return apps.ConfigValues(vals), nil
+	}
+	tmplVals, err := renderValues(spec.ValuesTemplate, robot)
+	if err != nil {
+		return nil, err
+	}
+	if vals == nil {
+		vals = chartutil.Values{}
+	}
+	vals.MergeInto(chartutil.Values(tmplVals))
+	return apps.ConfigValues(vals), nil
+}
+
+// renderValues returns a copy of the values in which all strings that
+// contain a template, e.g. "{{ .robot.labels.site }}", are rendered with
+// the robot's values.
+func renderValues(vals apps.ConfigValues, robot robotValues) (apps.ConfigValues, error) {
+	data := map[string]interface{}{
+		"robot": map[string]interface{}{
+			"name":        robot.Name,
+			"type":        robot.Type,
+			"project":     robot.Project,
+			"labels":      robot.Labels,
+			"annotations": robot.Annotations,
+		},
+	}
+	res, err := renderValue(map[string]interface{}(vals), data)
+	if err != nil {
+		return nil, err
+	}
+	return apps.ConfigValues(res.(map[string]interface{})), nil
+}
+
+func renderValue(v interface{}, data interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, errors.Wrap(err, k)
+			}
+			res[k] = r
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "[%d]", i)
+			}
+			res[i] = r
+		}
+		return res, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		// Missing labels and annotations render as empty strings.
+		tmpl, err := template.New("value").Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	default:
+		return v, nil
+	}
+}
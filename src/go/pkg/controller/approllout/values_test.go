@@ -0,0 +1,125 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package approllout
+
+import (
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	registry "github.com/googlecloudrobotics/core/src/go/pkg/apis/registry/v1alpha1"
+)
+
+func TestRenderValues(t *testing.T) {
+	robot := robotValues{
+		Name:   "robot1",
+		Type:   "mir-100",
+		Labels: map[string]string{"site": "munich"},
+	}
+	vals := apps.ConfigValues{
+		"plain": "{not a template}",
+		"num":   3,
+		"site":  "{{ .robot.labels.site }}",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"{{ .robot.name }}-{{ .robot.type }}", true},
+		},
+		"missing": "{{ .robot.labels.floor }}",
+		"sprig":   `{{ .robot.annotations.owner | default "nobody" | upper }}`,
+	}
+	want := apps.ConfigValues{
+		"plain": "{not a template}",
+		"num":   3,
+		"site":  "munich",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"robot1-mir-100", true},
+		},
+		"missing": "",
+		"sprig":   "NOBODY",
+	}
+	got, err := renderValues(vals, robot)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want values\n%v\ngot\n%v", want, got)
+	}
+	if _, ok := vals["site"].(string); !ok || vals["site"] != "{{ .robot.labels.site }}" {
+		t.Errorf("input values were modified: %v", vals)
+	}
+
+	if _, err := renderValues(apps.ConfigValues{"a": "{{ .robot.name"}, robot); err == nil {
+		t.Error("expected error for invalid template")
+	}
+}
+
+func TestNewRobotValues(t *testing.T) {
+	robot := &registry.Robot{}
+	robot.Name = "robot1"
+	robot.Annotations = map[string]string{
+		"values.cloudrobotics.com/owner":                   "alice",
+		"cloudrobotics.com/active-mission":                 "deliver-parcel",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}
+	want := map[string]string{"owner": "alice"}
+	if got := newRobotValues(robot).Annotations; !reflect.DeepEqual(got, want) {
+		t.Errorf("want annotations %v, got %v", want, got)
+	}
+
+	// Changing other annotations doesn't change the values.
+	updated := robot.DeepCopy()
+	updated.Annotations["cloudrobotics.com/active-mission"] = "charge"
+	if robotValuesChanged(robot, updated) {
+		t.Error("expected no change of the values for other annotations")
+	}
+	updated.Annotations["values.cloudrobotics.com/owner"] = "bob"
+	if !robotValuesChanged(robot, updated) {
+		t.Error("expected change of the values")
+	}
+}
+
+func TestRobotSpecValues(t *testing.T) {
+	robot := robotValues{Name: "robot1"}
+	spec := &apps.AppRolloutSpecRobot{
+		Values: apps.ConfigValues{
+			"alert": "{{ $labels.instance }} is down",
+			"nested": map[string]interface{}{
+				"host": "default.example.com",
+				"port": int64(80),
+			},
+		},
+		ValuesTemplate: apps.ConfigValues{
+			"nested": map[string]interface{}{
+				"host": "{{ .robot.name }}.example.com",
+			},
+		},
+	}
+	want := apps.ConfigValues{
+		"alert": "{{ $labels.instance }} is down",
+		"nested": map[string]interface{}{
+			"host": "robot1.example.com",
+			"port": int64(80),
+		},
+	}
+	got, err := robotSpecValues(spec, robot)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want values\n%v\ngot\n%v", want, got)
+	}
+	if host := spec.Values["nested"].(map[string]interface{})["host"]; host != "default.example.com" {
+		t.Errorf("input values were modified: %v", spec.Values)
+	}
+}
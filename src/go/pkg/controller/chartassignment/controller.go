@@ -17,9 +17,12 @@ package chartassignment
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,18 +30,24 @@ import (
 	"github.com/googlecloudrobotics/core/src/go/pkg/gcr"
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/validation"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metavalidation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/helm/pkg/chartutil"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -49,23 +58,86 @@ const (
 	// SA in a new namespace.
 	defaultServiceAccountDeadline = time.Minute
 
-	fieldIndexNamespace = "spec.namespaceName"
+	fieldIndexNamespace  = "spec.namespaceName"
+	fieldIndexValuesFrom = "spec.chart.valuesFrom"
+	fieldIndexDependsOn  = "spec.dependsOn"
+
+	// Key of the values in Secrets and ConfigMaps referenced by valuesFrom
+	// if none is specified.
+	defaultValuesKey = "values.yaml"
+
+	// Label of ResourceSets that holds the name of their ChartAssignment.
+	labelResourceSetName = "name"
+
+	// Annotations on namespaces that hold the keys of the labels and
+	// annotations set from spec.namespace, so they are removed once unset.
+	annotationManagedLabels      = "cloudrobotics.com/managed-labels"
+	annotationManagedAnnotations = "cloudrobotics.com/managed-annotations"
+
+	DefaultResyncPeriod  = 10 * time.Minute
+	DefaultRequeuePeriod = 3 * time.Second
 )
 
+var chartAssignmentKind = apps.SchemeGroupVersion.WithKind("ChartAssignment")
+
+// Options configures the ChartAssignment controller.
+type Options struct {
+	// ResyncPeriod is the interval at which ChartAssignments are reconciled
+	// even if neither they nor their resources changed.
+	// Defaults to DefaultResyncPeriod.
+	ResyncPeriod time.Duration
+	// RequeuePeriod is the interval at which ChartAssignments are reconciled
+	// while their release is in progress or waiting on a transient error.
+	// Defaults to DefaultRequeuePeriod.
+	RequeuePeriod time.Duration
+	// ManifestHistory is the number of generations whose applied manifests
+	// are kept in Secrets. Defaults to DefaultManifestHistory, negative
+	// values disable the history.
+	ManifestHistory int
+}
+
 // Add adds a controller and validation webhook for the ChartAssignment resource type
 // to the manager and server.
 // Handled ChartAssignments are filtered by the provided cluster.
-func Add(mgr manager.Manager, cluster string) error {
+func Add(mgr manager.Manager, cluster string, opts Options) error {
 	r := &Reconciler{
-		kube:     mgr.GetClient(),
-		recorder: mgr.GetEventRecorderFor("chartassignment-controller"),
-		cluster:  cluster,
+		kube:          mgr.GetClient(),
+		recorder:      mgr.GetEventRecorderFor("chartassignment-controller"),
+		cluster:       cluster,
+		resyncPeriod:  opts.ResyncPeriod,
+		requeuePeriod: opts.RequeuePeriod,
+	}
+	if r.resyncPeriod <= 0 {
+		r.resyncPeriod = DefaultResyncPeriod
 	}
+	if r.requeuePeriod <= 0 {
+		r.requeuePeriod = DefaultRequeuePeriod
+	}
+	// Releases notify the controller through this channel when they
+	// finished applying or deleting a chart.
+	events := make(chan event.GenericEvent)
+
 	var err error
-	r.releases, err = newReleases(mgr.GetConfig(), r.recorder)
+	r.releases, err = newReleases(mgr.GetConfig(), r.recorder, events)
 	if err != nil {
 		return err
 	}
+	// Watches of valuesFrom sources notify the controller through this
+	// channel when a source changed.
+	valuesFromEvents := make(chan event.GenericEvent)
+
+	kube, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	r.valuesFrom = newValuesFromSources(kube, valuesFromEvents)
+
+	switch {
+	case opts.ManifestHistory > 0:
+		r.releases.manifestHistory = opts.ManifestHistory
+	case opts.ManifestHistory == 0:
+		r.releases.manifestHistory = DefaultManifestHistory
+	}
 
 	c, err := controller.New("chartassignment", mgr, controller.Options{
 		Reconciler: r,
@@ -73,6 +145,9 @@ func Add(mgr manager.Manager, cluster string) error {
 	if err != nil {
 		return err
 	}
+	if err := metrics.Registry.Register(&phaseCollector{kube: mgr.GetClient()}); err != nil {
+		return errors.Wrap(err, "register metrics")
+	}
 	err = mgr.GetCache().IndexField(&apps.ChartAssignment{}, fieldIndexNamespace,
 		func(o runtime.Object) []string {
 			return []string{o.(*apps.ChartAssignment).Spec.NamespaceName}
@@ -81,6 +156,18 @@ func Add(mgr manager.Manager, cluster string) error {
 	if err != nil {
 		return errors.Wrap(err, "add field indexer")
 	}
+	err = mgr.GetCache().IndexField(&apps.ChartAssignment{}, fieldIndexValuesFrom, indexValuesFrom)
+	if err != nil {
+		return errors.Wrap(err, "add field indexer")
+	}
+	err = mgr.GetCache().IndexField(&apps.ChartAssignment{}, fieldIndexDependsOn,
+		func(o runtime.Object) []string {
+			return o.(*apps.ChartAssignment).Spec.DependsOn
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "add field indexer")
+	}
 	err = c.Watch(
 		&source.Kind{Type: &apps.ChartAssignment{}},
 		&handler.EnqueueRequestForObject{},
@@ -88,31 +175,184 @@ func Add(mgr manager.Manager, cluster string) error {
 	if err != nil {
 		return err
 	}
+	// Dependent ChartAssignments wait for the ones they depend on to
+	// become Ready.
+	err = c.Watch(
+		&source.Kind{Type: &apps.ChartAssignment{}},
+		&handler.Funcs{
+			CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueDependents(e.Meta.GetName(), q)
+			},
+			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueDependents(e.MetaNew.GetName(), q)
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch dependencies")
+	}
+	err = c.Watch(
+		&source.Channel{Source: events},
+		&handler.EnqueueRequestForObject{},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch releases")
+	}
+	err = c.Watch(
+		&source.Kind{Type: &apps.ResourceSet{}},
+		&handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+				name, ok := o.Meta.GetLabels()[labelResourceSetName]
+				if !ok {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: kclient.ObjectKey{Name: name}}}
+			}),
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch ResourceSets")
+	}
+	err = c.Watch(
+		&source.Kind{Type: &core.Namespace{}},
+		&handler.Funcs{
+			CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueForNamespace(e.Meta.GetName(), q)
+			},
+			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueForNamespace(e.MetaNew.GetName(), q)
+			},
+			DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+				r.enqueueForNamespace(e.Meta.GetName(), q)
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch Namespaces")
+	}
 	err = c.Watch(
 		&source.Kind{Type: &core.Pod{}},
 		&handler.Funcs{
 			CreateFunc: func(e event.CreateEvent, q workqueue.RateLimitingInterface) {
-				r.enqueueForPod(e.Meta, q)
+				r.enqueueForNamespace(e.Meta.GetNamespace(), q)
 			},
 			UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
-				r.enqueueForPod(e.MetaNew, q)
+				r.enqueueForNamespace(e.MetaNew.GetNamespace(), q)
 			},
 			DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
-				r.enqueueForPod(e.Meta, q)
+				r.enqueueForNamespace(e.Meta.GetNamespace(), q)
 			},
 		},
 	)
 	if err != nil {
-		return errors.Wrap(err, "watch Apps")
+		return errors.Wrap(err, "watch Pods")
+	}
+	err = c.Watch(
+		&source.Kind{Type: &core.ResourceQuota{}},
+		&handler.EnqueueRequestForOwner{OwnerType: &apps.ChartAssignment{}, IsController: true},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch ResourceQuotas")
+	}
+	err = c.Watch(
+		&source.Kind{Type: &core.LimitRange{}},
+		&handler.EnqueueRequestForOwner{OwnerType: &apps.ChartAssignment{}, IsController: true},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch LimitRanges")
+	}
+	// Only the Secrets and ConfigMaps referenced in valuesFrom are watched,
+	// see valuesFromSources.
+	err = c.Watch(
+		&source.Channel{Source: valuesFromEvents},
+		&handler.Funcs{
+			GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+				switch e.Object.(type) {
+				case *core.Secret:
+					r.enqueueForValuesFrom(apps.ValuesFromSourceSecret, e.Meta, q)
+				case *core.ConfigMap:
+					r.enqueueForValuesFrom(apps.ValuesFromSourceConfigMap, e.Meta, q)
+				}
+			},
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "watch valuesFrom sources")
 	}
 	return nil
 }
 
-func (r *Reconciler) enqueueForPod(m meta.Object, q workqueue.RateLimitingInterface) {
+// indexValuesFrom indexes ChartAssignments by the Secrets and ConfigMaps
+// their chart values are loaded from.
+func indexValuesFrom(o runtime.Object) []string {
+	as := o.(*apps.ChartAssignment)
+	var keys []string
+	for _, src := range as.Spec.Chart.ValuesFrom {
+		keys = append(keys, valuesFromKey(src.Kind, valuesFromNamespace(as, src), src.Name))
+	}
+	return keys
+}
+
+func valuesFromKey(kind apps.ValuesFromSourceKind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+func valuesFromNamespace(as *apps.ChartAssignment, src apps.ValuesFromSource) string {
+	if src.Namespace != "" {
+		return src.Namespace
+	}
+	return as.Spec.NamespaceName
+}
+
+func (r *Reconciler) enqueueForValuesFrom(kind apps.ValuesFromSourceKind, m meta.Object, q workqueue.RateLimitingInterface) {
+	var cas apps.ChartAssignmentList
+	key := valuesFromKey(kind, m.GetNamespace(), m.GetName())
+	err := r.kube.List(context.TODO(), &cas, kclient.MatchingField(fieldIndexValuesFrom, key))
+	if err != nil {
+		log.Printf("List ChartAssignments for %s failed: %s", key, err)
+		return
+	}
+	for _, ca := range cas.Items {
+		q.Add(reconcile.Request{
+			NamespacedName: kclient.ObjectKey{Name: ca.Name},
+		})
+	}
+}
+
+// pruneValuesFrom stops watching valuesFrom sources that no ChartAssignment
+// references anymore.
+func (r *Reconciler) pruneValuesFrom(ctx context.Context) {
+	r.valuesFrom.prune(func(key string) bool {
+		var cas apps.ChartAssignmentList
+		err := r.kube.List(ctx, &cas, kclient.MatchingField(fieldIndexValuesFrom, key))
+		// Keep watching if we can't tell.
+		return err != nil || len(cas.Items) > 0
+	})
+}
+
+// enqueueForNamespace enqueues the ChartAssignments installed into the
+// namespace.
+func (r *Reconciler) enqueueForNamespace(ns string, q workqueue.RateLimitingInterface) {
 	var cas apps.ChartAssignmentList
-	err := r.kube.List(context.TODO(), &cas, kclient.MatchingField(fieldIndexNamespace, m.GetNamespace()))
+	err := r.kube.List(context.TODO(), &cas, kclient.MatchingField(fieldIndexNamespace, ns))
 	if err != nil {
-		log.Printf("List ChartAssignments for namespace %s failed: %s", m.GetNamespace(), err)
+		log.Printf("List ChartAssignments for namespace %s failed: %s", ns, err)
+		return
+	}
+	for _, ca := range cas.Items {
+		q.Add(reconcile.Request{
+			NamespacedName: kclient.ObjectKey{Name: ca.Name},
+		})
+	}
+}
+
+// enqueueDependents enqueues the ChartAssignments that depend on the named
+// one.
+func (r *Reconciler) enqueueDependents(name string, q workqueue.RateLimitingInterface) {
+	var cas apps.ChartAssignmentList
+	err := r.kube.List(context.TODO(), &cas, kclient.MatchingField(fieldIndexDependsOn, name))
+	if err != nil {
+		log.Printf("List ChartAssignments depending on %s failed: %s", name, err)
 		return
 	}
 	for _, ca := range cas.Items {
@@ -129,18 +369,33 @@ type Reconciler struct {
 	recorder record.EventRecorder
 	cluster  string // Cluster for which to handle ChartAssignments.
 	releases *releases
+	// Watches of the Secrets and ConfigMaps referenced in valuesFrom.
+	valuesFrom *valuesFromSources
+
+	resyncPeriod  time.Duration
+	requeuePeriod time.Duration
 }
 
 // Reconcile creates and updates a Synk ResourceSet for the given chart
-// assignment. It rolls back releases to the previous revision if an upgrade
-// failed. It continuously requeues the ChartAssignment for reconciliation to
-// monitor the status of the ResourceSet.
+// assignment. If rollback is enabled, it re-applies the last Ready generation
+// when an update failed or did not become Ready in time. Changes to the
+// ResourceSet, the namespace and its pods trigger reconciliation. Beyond that,
+// the ChartAssignment is only requeued quickly while its release is in
+// progress and otherwise resynced periodically.
 func (r *Reconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
 	ctx := context.TODO()
 
 	var as apps.ChartAssignment
 	err := r.kube.Get(ctx, req.NamespacedName, &as)
 
+	// Only check for unreferenced valuesFrom sources if the
+	// ChartAssignment was deleted or its references changed.
+	if err == nil || k8serrors.IsNotFound(err) {
+		if r.valuesFrom.setReferences(req.Name, indexValuesFrom(&as)) {
+			r.pruneValuesFrom(ctx)
+		}
+	}
+
 	if as.Spec.ClusterName != r.cluster {
 		return reconcile.Result{}, nil
 	}
@@ -159,10 +414,6 @@ const (
 	// The finalizer that's applied to assignments to block their garbage collection
 	// until the Synk ResourceSet is deleted.
 	finalizer = "helm.apps.cloudrobotics.com"
-	// Requeue interval when the underlying Synk ResourceSet is not in a stable state yet.
-	requeueFast = 3 * time.Second
-	// Requeue interval after the underlying Synk ResourceSete reached a stable state.
-	requeueSlow = 3 * time.Minute
 )
 
 // namespaceDeletionError indicates that a namespace could not be created
@@ -200,8 +451,22 @@ func (r *Reconciler) ensureNamespace(ctx context.Context, as *apps.ChartAssignme
 	}
 
 	createNamespace := k8serrors.IsNotFound(err)
+	orig := ns.ObjectMeta.DeepCopy()
 	ns.Name = as.Spec.NamespaceName
-	ns.Labels = map[string]string{"app": as.Name}
+
+	var spec apps.ChartAssignmentNamespace
+	if as.Spec.Namespace != nil {
+		spec = *as.Spec.Namespace
+	}
+	if ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	var managed string
+	ns.Labels, managed = setManaged(ns.Labels, spec.Labels, ns.Annotations[annotationManagedLabels])
+	setOrDelete(ns.Annotations, annotationManagedLabels, managed)
+	ns.Annotations, managed = setManaged(ns.Annotations, spec.Annotations, ns.Annotations[annotationManagedAnnotations])
+	setOrDelete(ns.Annotations, annotationManagedAnnotations, managed)
+	ns.Labels["app"] = as.Name
 
 	// Add ourselves to the owners if we aren't already.
 	_true := true
@@ -212,7 +477,9 @@ func (r *Reconciler) ensureNamespace(ctx context.Context, as *apps.ChartAssignme
 		UID:                as.UID,
 		BlockOwnerDeletion: &_true,
 	})
-	if !added {
+	changed := !apiequality.Semantic.DeepEqual(orig.Labels, ns.Labels) ||
+		!apiequality.Semantic.DeepEqual(orig.Annotations, ns.Annotations)
+	if !added && !changed {
 		return &ns, nil
 	}
 	if createNamespace {
@@ -221,42 +488,131 @@ func (r *Reconciler) ensureNamespace(ctx context.Context, as *apps.ChartAssignme
 	return &ns, r.kube.Update(ctx, &ns)
 }
 
-// ensureServiceAccount makes sure we have an image pull secret for gcr.io inside the apps namespace
-// and the default service account configured to use it. This is needed to make apps work that
-// reference images from a private container registry.
-// TODO(ensonic): Put this behind a flag to only do this as needed.
-func (r *Reconciler) ensureServiceAccount(ctx context.Context, ns *core.Namespace, as *apps.ChartAssignment) error {
-	if r.cluster == "cloud" {
-		// We don't need any of this for cloud charts.
+// setManaged sets the wanted labels or annotations in m and removes the
+// previously managed ones that are no longer wanted. It returns the updated
+// map and the keys that are managed now.
+func setManaged(m, want map[string]string, prev string) (map[string]string, string) {
+	if m == nil {
+		m = map[string]string{}
+	}
+	for _, k := range strings.Split(prev, ",") {
+		if _, ok := want[k]; !ok {
+			delete(m, k)
+		}
+	}
+	var keys []string
+	for k, v := range want {
+		m[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return m, strings.Join(keys, ",")
+}
+
+func setOrDelete(m map[string]string, k, v string) {
+	if v == "" {
+		delete(m, k)
+	} else {
+		m[k] = v
+	}
+}
+
+// ensureResourceQuota creates, updates, or deletes the ResourceQuota in the
+// namespace of the ChartAssignment according to its spec.
+func (r *Reconciler) ensureResourceQuota(ctx context.Context, as *apps.ChartAssignment) error {
+	var rq core.ResourceQuota
+	err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: as.Spec.NamespaceName, Name: as.Name}, &rq)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "get ResourceQuota")
+	}
+	exists := err == nil
+
+	if as.Spec.Namespace == nil || as.Spec.Namespace.ResourceQuota == nil {
+		if exists && meta.IsControlledBy(&rq, as) {
+			return kclient.IgnoreNotFound(r.kube.Delete(ctx, &rq))
+		}
+		return nil
+	}
+	spec := as.Spec.Namespace.ResourceQuota
+	if !exists {
+		rq = core.ResourceQuota{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:       as.Spec.NamespaceName,
+				Name:            as.Name,
+				OwnerReferences: []meta.OwnerReference{*meta.NewControllerRef(as, chartAssignmentKind)},
+			},
+			Spec: *spec.DeepCopy(),
+		}
+		return r.kube.Create(ctx, &rq)
+	}
+	if apiequality.Semantic.DeepEqual(rq.Spec, *spec) {
 		return nil
 	}
+	rq.Spec = *spec.DeepCopy()
+	return r.kube.Update(ctx, &rq)
+}
 
-	// Copy imagePullSecret from 'default' namespace, since service accounts cannot reference
-	// secrets in other namespaces.
-	var secret core.Secret
-	err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: as.Spec.NamespaceName, Name: gcr.SecretName}, &secret)
-	if k8serrors.IsNotFound(err) {
-		err = r.kube.Get(ctx, kclient.ObjectKey{Namespace: "default", Name: gcr.SecretName}, &secret)
-		if k8serrors.IsNotFound(err) {
-			log.Printf("Failed to get Secret \"default:%s\" (this is expected when simulating a robot on GKE)", gcr.SecretName)
-			return nil
-		} else if err != nil {
-			return fmt.Errorf("getting Secret \"default:%s\" failed: %s", gcr.SecretName, err)
+// ensureLimitRange creates, updates, or deletes the LimitRange in the
+// namespace of the ChartAssignment according to its spec.
+func (r *Reconciler) ensureLimitRange(ctx context.Context, as *apps.ChartAssignment) error {
+	var lr core.LimitRange
+	err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: as.Spec.NamespaceName, Name: as.Name}, &lr)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrap(err, "get LimitRange")
+	}
+	exists := err == nil
+
+	if as.Spec.Namespace == nil || as.Spec.Namespace.LimitRange == nil {
+		if exists && meta.IsControlledBy(&lr, as) {
+			return kclient.IgnoreNotFound(r.kube.Delete(ctx, &lr))
 		}
-		// Don't reuse full metadata in created secret.
-		secret.ObjectMeta = meta.ObjectMeta{
-			Namespace: ns.Name,
-			Name:      gcr.SecretName,
+		return nil
+	}
+	spec := as.Spec.Namespace.LimitRange
+	if !exists {
+		lr = core.LimitRange{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace:       as.Spec.NamespaceName,
+				Name:            as.Name,
+				OwnerReferences: []meta.OwnerReference{*meta.NewControllerRef(as, chartAssignmentKind)},
+			},
+			Spec: *spec.DeepCopy(),
 		}
-		err = r.kube.Create(ctx, &secret)
+		return r.kube.Create(ctx, &lr)
+	}
+	if apiequality.Semantic.DeepEqual(lr.Spec, *spec) {
+		return nil
+	}
+	lr.Spec = *spec.DeepCopy()
+	return r.kube.Update(ctx, &lr)
+}
+
+// ensureServiceAccount makes sure the image pull secrets of the registries
+// used by the ChartAssignment exist inside the apps namespace and the default
+// service account is configured to use them. This is needed to make apps work
+// that reference images from a private container registry.
+func (r *Reconciler) ensureServiceAccount(ctx context.Context, ns *core.Namespace, as *apps.ChartAssignment) error {
+	var names []string
+	for _, reg := range r.imagePullRegistries(as) {
+		name := reg.SecretName
+		if name == "" {
+			name = gcr.SecretName
+		}
+		ok, err := r.ensureImagePullSecret(ctx, ns, name, reg.Host)
 		if err != nil {
-			return fmt.Errorf("creating Secret \"%s:%s\" failed: %s", as.Spec.NamespaceName, gcr.SecretName, err)
+			return err
 		}
+		if ok && !stringsContain(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
 	}
 
 	// Configure the default service account in the namespace.
 	var sa core.ServiceAccount
-	err = r.kube.Get(ctx, kclient.ObjectKey{Namespace: as.Spec.NamespaceName, Name: "default"}, &sa)
+	err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: as.Spec.NamespaceName, Name: "default"}, &sa)
 	if err != nil {
 		if k8serrors.IsNotFound(err) && time.Since(ns.CreationTimestamp.Time) < defaultServiceAccountDeadline {
 			// The Service Account Controller hasn't created the default SA yet.
@@ -267,21 +623,137 @@ func (r *Reconciler) ensureServiceAccount(ctx context.Context, ns *core.Namespac
 		return fmt.Errorf("getting ServiceAccount \"%s:default\" failed: %s", as.Spec.NamespaceName, err)
 	}
 
-	// Only add the secret once.
-	ips := core.LocalObjectReference{Name: gcr.SecretName}
-	found := false
-	for _, s := range sa.ImagePullSecrets {
-		if s == ips {
-			found = true
-			break
+	// Only add each secret once.
+	changed := false
+	for _, name := range names {
+		ips := core.LocalObjectReference{Name: name}
+		found := false
+		for _, s := range sa.ImagePullSecrets {
+			if s == ips {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sa.ImagePullSecrets = append(sa.ImagePullSecrets, ips)
+			changed = true
 		}
 	}
-	if !found {
-		sa.ImagePullSecrets = append(sa.ImagePullSecrets, ips)
+	if !changed {
+		return nil
 	}
 	return r.kube.Update(ctx, &sa)
 }
 
+// imagePullRegistries returns the registries whose pull secrets should be
+// attached to the default service account of the ChartAssignment's namespace.
+func (r *Reconciler) imagePullRegistries(as *apps.ChartAssignment) []apps.ImagePullRegistry {
+	ip := as.Spec.ImagePull
+	if ip == nil {
+		if r.cluster == "cloud" {
+			// We don't need any of this for cloud charts by default.
+			return nil
+		}
+		// The gcr.io pull secret is maintained by the GCR credential
+		// refresher on robots, so there is no need to check its hosts.
+		return []apps.ImagePullRegistry{{SecretName: gcr.SecretName}}
+	}
+	if ip.Disabled {
+		return nil
+	}
+	return ip.Registries
+}
+
+// ensureImagePullSecret copies the named docker registry Secret from the
+// 'default' namespace into the apps namespace, since service accounts cannot
+// reference secrets in other namespaces. If host is set, the secret must
+// contain credentials for it.
+// It returns false if there's no such secret to use.
+func (r *Reconciler) ensureImagePullSecret(ctx context.Context, ns *core.Namespace, name, host string) (bool, error) {
+	var src, dst core.Secret
+	err := r.kube.Get(ctx, kclient.ObjectKey{Namespace: "default", Name: name}, &src)
+	if k8serrors.IsNotFound(err) {
+		// Keep using an existing copy in the apps namespace.
+		err = r.kube.Get(ctx, kclient.ObjectKey{Namespace: ns.Name, Name: name}, &dst)
+		if k8serrors.IsNotFound(err) {
+			log.Printf("Failed to get Secret \"default:%s\" (this is expected when simulating a robot on GKE)", name)
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("getting Secret \"%s:%s\" failed: %s", ns.Name, name, err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("getting Secret \"default:%s\" failed: %s", name, err)
+	}
+	if host != "" {
+		hosts, err := registryHosts(&src)
+		if err != nil {
+			return false, fmt.Errorf("invalid docker registry Secret \"default:%s\": %s", name, err)
+		}
+		if !stringsContain(hosts, host) {
+			return false, fmt.Errorf("Secret \"default:%s\" has no credentials for registry %q", name, host)
+		}
+	}
+
+	err = r.kube.Get(ctx, kclient.ObjectKey{Namespace: ns.Name, Name: name}, &dst)
+	if k8serrors.IsNotFound(err) {
+		// Don't reuse full metadata in created secret.
+		dst = core.Secret{
+			ObjectMeta: meta.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      name,
+			},
+			Type: src.Type,
+			Data: src.Data,
+		}
+		if err := r.kube.Create(ctx, &dst); err != nil {
+			return false, fmt.Errorf("creating Secret \"%s:%s\" failed: %s", ns.Name, name, err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("getting Secret \"%s:%s\" failed: %s", ns.Name, name, err)
+	}
+	// Keep the copy in sync with rotated credentials. The type of a secret
+	// is immutable.
+	if dst.Type == src.Type && !reflect.DeepEqual(dst.Data, src.Data) {
+		dst.Data = src.Data
+		if err := r.kube.Update(ctx, &dst); err != nil {
+			return false, fmt.Errorf("updating Secret \"%s:%s\" failed: %s", ns.Name, name, err)
+		}
+	}
+	return true, nil
+}
+
+// registryHosts returns the hosts of the registries a docker registry Secret
+// holds credentials for.
+func registryHosts(s *core.Secret) ([]string, error) {
+	var auths map[string]json.RawMessage
+
+	switch s.Type {
+	case core.SecretTypeDockercfg:
+		if err := json.Unmarshal(s.Data[core.DockerConfigKey], &auths); err != nil {
+			return nil, err
+		}
+	case core.SecretTypeDockerConfigJson:
+		var cfg struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(s.Data[core.DockerConfigJsonKey], &cfg); err != nil {
+			return nil, err
+		}
+		auths = cfg.Auths
+	default:
+		return nil, fmt.Errorf("unexpected type %q", s.Type)
+	}
+	var hosts []string
+	for k := range auths {
+		// Keys may be URLs like "https://gcr.io/v1/".
+		k = strings.TrimPrefix(strings.TrimPrefix(k, "https://"), "http://")
+		hosts = append(hosts, strings.SplitN(k, "/", 2)[0])
+	}
+	return hosts, nil
+}
+
 func (r *Reconciler) reconcile(ctx context.Context, as *apps.ChartAssignment) (reconcile.Result, error) {
 	// If we are scheduled for deletion, delete the Synk ResourceSet and drop our
 	// finalizer so garbage collection can continue.
@@ -295,7 +767,29 @@ func (r *Reconciler) reconcile(ctx context.Context, as *apps.ChartAssignment) (r
 			return reconcile.Result{}, fmt.Errorf("set status: %s", err)
 		}
 		// Requeue to track deletion progress.
-		return reconcile.Result{Requeue: true, RequeueAfter: requeueFast}, nil
+		return reconcile.Result{Requeue: true, RequeueAfter: r.requeuePeriod}, nil
+	}
+	// Leave the app alone while paused. Unpausing changes the spec and
+	// thus triggers reconciliation again.
+	if as.Spec.Paused {
+		if err := r.setPausedStatus(ctx, as); err != nil && !k8serrors.IsConflict(err) {
+			return reconcile.Result{}, errors.Wrap(err, "update status")
+		}
+		return reconcile.Result{}, nil
+	}
+	// Hold off applying a new generation until its dependencies are Ready.
+	// Changes to the dependencies trigger reconciliation again.
+	if waitForDependencies(as) {
+		waiting, err := r.unreadyDependencies(ctx, as)
+		if err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "check dependencies")
+		}
+		if len(waiting) > 0 {
+			if err := r.setWaitingStatus(ctx, as, waiting); err != nil && !k8serrors.IsConflict(err) {
+				return reconcile.Result{}, errors.Wrap(err, "update status")
+			}
+			return reconcile.Result{}, nil
+		}
 	}
 
 	ns, err := r.ensureNamespace(ctx, as)
@@ -303,14 +797,20 @@ func (r *Reconciler) reconcile(ctx context.Context, as *apps.ChartAssignment) (r
 		if _, ok := err.(*namespaceDeletionError); ok {
 			log.Printf("ensure namespace: %s", err)
 			// Requeue to track deletion progress.
-			return reconcile.Result{Requeue: true, RequeueAfter: requeueFast}, nil
+			return reconcile.Result{Requeue: true, RequeueAfter: r.requeuePeriod}, nil
 		}
 		return reconcile.Result{}, fmt.Errorf("ensure namespace: %s", err)
 	}
+	if err := r.ensureResourceQuota(ctx, as); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure ResourceQuota")
+	}
+	if err := r.ensureLimitRange(ctx, as); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "ensure LimitRange")
+	}
 	if err := r.ensureServiceAccount(ctx, ns, as); err != nil {
 		if _, ok := err.(*missingServiceAccountError); ok {
 			log.Printf("Failed: %q. This is expected to occur rarely.", err)
-			return reconcile.Result{Requeue: true, RequeueAfter: requeueFast}, nil
+			return reconcile.Result{Requeue: true, RequeueAfter: r.requeuePeriod}, nil
 		} else {
 			return reconcile.Result{}, fmt.Errorf("ensure service-account: %s", err)
 		}
@@ -324,7 +824,18 @@ func (r *Reconciler) reconcile(ctx context.Context, as *apps.ChartAssignment) (r
 		}
 	}
 
-	r.releases.ensureUpdated(as)
+	valuesFrom, err := r.loadValuesFrom(ctx, as)
+	if err != nil {
+		r.recorder.Event(as, core.EventTypeWarning, "Failure", err.Error())
+		return reconcile.Result{}, errors.Wrap(err, "load valuesFrom")
+	}
+	err = r.releases.restoreLastReady(as, func(last *apps.ChartAssignment) ([]chartutil.Values, error) {
+		return r.loadValuesFrom(ctx, last)
+	})
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "load valuesFrom of last Ready generation")
+	}
+	r.releases.ensureUpdated(as, valuesFrom)
 
 	if err := r.setStatus(ctx, as); err != nil {
 		if k8serrors.IsConflict(err) {
@@ -336,14 +847,82 @@ func (r *Reconciler) reconcile(ctx context.Context, as *apps.ChartAssignment) (r
 		return reconcile.Result{}, errors.Wrap(err, "update status")
 	}
 	// Quickly requeue for status updates when deployment is in progress.
+	// Once settled, watches on the namespace's pods trigger updates. Only
+	// a pending rollback deadline requires checking back earlier.
 	switch as.Status.Phase {
 	case apps.ChartAssignmentPhaseReady, apps.ChartAssignmentPhaseFailed:
-		return reconcile.Result{Requeue: true, RequeueAfter: requeueSlow}, nil
+		return reconcile.Result{Requeue: true, RequeueAfter: r.resyncPeriod}, nil
+	case apps.ChartAssignmentPhaseSettled:
+		if as.Spec.Rollback == nil || as.Status.Rollback != nil {
+			return reconcile.Result{Requeue: true, RequeueAfter: r.resyncPeriod}, nil
+		}
 	}
-	return reconcile.Result{Requeue: true, RequeueAfter: requeueFast}, nil
+	return reconcile.Result{Requeue: true, RequeueAfter: r.requeuePeriod}, nil
 
 }
 
+// loadValuesFrom returns the chart values loaded from the Secrets and
+// ConfigMaps referenced in the chart's valuesFrom, in the listed order.
+func (r *Reconciler) loadValuesFrom(ctx context.Context, as *apps.ChartAssignment) ([]chartutil.Values, error) {
+	var res []chartutil.Values
+
+	for _, src := range as.Spec.Chart.ValuesFrom {
+		key := kclient.ObjectKey{Namespace: valuesFromNamespace(as, src), Name: src.Name}
+		valuesKey := src.ValuesKey
+		if valuesKey == "" {
+			valuesKey = defaultValuesKey
+		}
+		obj, err := r.valuesFrom.get(src.Kind, key.Namespace, key.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get %s %q", src.Kind, key)
+		}
+		var (
+			data  []byte
+			found bool
+		)
+		switch o := obj.(type) {
+		case *core.Secret:
+			data, found = o.Data[valuesKey]
+		case *core.ConfigMap:
+			var v string
+			v, found = o.Data[valuesKey]
+			data = []byte(v)
+		}
+		if !found {
+			if src.Optional {
+				continue
+			}
+			return nil, errors.Errorf("key %q of %s %q not found", valuesKey, src.Kind, key)
+		}
+		vals, err := parseValuesFrom(data, src.TargetPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse key %q of %s %q", valuesKey, src.Kind, key)
+		}
+		res = append(res, vals)
+	}
+	return res, nil
+}
+
+// parseValuesFrom returns the values for data loaded from a valuesFrom
+// source. Without a target path, data is parsed as a values file. Otherwise
+// it is set as a string at the dot-separated target path.
+func parseValuesFrom(data []byte, targetPath string) (chartutil.Values, error) {
+	if targetPath == "" {
+		return chartutil.ReadValues(data)
+	}
+	vals := chartutil.Values{}
+	cur := map[string]interface{}(vals)
+	keys := strings.Split(targetPath, ".")
+
+	for _, k := range keys[:len(keys)-1] {
+		next := map[string]interface{}{}
+		cur[k] = next
+		cur = next
+	}
+	cur[keys[len(keys)-1]] = string(data)
+	return vals, nil
+}
+
 func condition(b bool) core.ConditionStatus {
 	if b {
 		return core.ConditionTrue
@@ -406,6 +985,92 @@ func (r *Reconciler) setStatus(ctx context.Context, as *apps.ChartAssignment) er
 				fmt.Sprintf("%d/%d pods are running or succeeded", ready, total))
 		}
 	}
+	if as.Status.Phase == apps.ChartAssignmentPhaseReady {
+		if r.releases.setReady(as) && as.Spec.Rollback != nil {
+			// Keep the Ready generation across restarts of the controller.
+			as.Status.LastReady = &apps.ChartAssignmentLastReady{
+				Generation: as.Generation,
+				Spec:       *as.Spec.DeepCopy(),
+			}
+		}
+	} else if r.releases.ensureRolledBack(as, as.Status.Phase) {
+		log.Printf("Rolling back ChartAssignment %q from generation %d", as.Name, as.Generation)
+	}
+	if status, ok := r.releases.status(as.Name); ok {
+		as.Status.Rollback = status.rollback
+		as.Status.Failure = status.failure
+		// The release only knows the manifests it applied itself.
+		if status.manifests != nil {
+			as.Status.Manifests = status.manifests
+		}
+	}
+	return r.kube.Status().Update(ctx, as)
+}
+
+// setPausedStatus updates the status of a paused ChartAssignment.
+func (r *Reconciler) setPausedStatus(ctx context.Context, as *apps.ChartAssignment) error {
+	if as.Status.Phase == apps.ChartAssignmentPhasePaused && as.Status.ObservedGeneration == as.Generation {
+		return nil
+	}
+	as.Status.ObservedGeneration = as.Generation
+	as.Status.Phase = apps.ChartAssignmentPhasePaused
+	setCondition(as, apps.ChartAssignmentConditionSettled, core.ConditionFalse, "ChartAssignment is paused")
+	return r.kube.Status().Update(ctx, as)
+}
+
+// waitForDependencies returns true if the ChartAssignment's dependencies must
+// be Ready before it is applied. This is the case until the current
+// generation has been applied once, so that dependencies that are updated
+// later don't block the ChartAssignment.
+func waitForDependencies(as *apps.ChartAssignment) bool {
+	if len(as.Spec.DependsOn) == 0 {
+		return false
+	}
+	return as.Status.ObservedGeneration != as.Generation ||
+		as.Status.Phase == apps.ChartAssignmentPhaseWaitingForDependencies
+}
+
+// unreadyDependencies returns the names of the ChartAssignments in
+// spec.dependsOn that don't exist or are not Ready.
+func (r *Reconciler) unreadyDependencies(ctx context.Context, as *apps.ChartAssignment) ([]string, error) {
+	var waiting []string
+	for _, name := range as.Spec.DependsOn {
+		var dep apps.ChartAssignment
+		if err := r.kube.Get(ctx, kclient.ObjectKey{Name: name}, &dep); err != nil {
+			if k8serrors.IsNotFound(err) {
+				waiting = append(waiting, name)
+				continue
+			}
+			return nil, errors.Wrapf(err, "get ChartAssignment %q", name)
+		}
+		if !dependencyReady(as, &dep) {
+			waiting = append(waiting, name)
+		}
+	}
+	return waiting, nil
+}
+
+// dependencyReady returns true if the dependency is installed on the same
+// cluster and Ready for its current generation.
+func dependencyReady(as, dep *apps.ChartAssignment) bool {
+	return dep.Spec.ClusterName == as.Spec.ClusterName &&
+		dep.DeletionTimestamp == nil &&
+		dep.Status.ObservedGeneration == dep.Generation &&
+		dep.Status.Phase == apps.ChartAssignmentPhaseReady
+}
+
+// setWaitingStatus updates the status of a ChartAssignment that waits for
+// its dependencies.
+func (r *Reconciler) setWaitingStatus(ctx context.Context, as *apps.ChartAssignment, waiting []string) error {
+	msg := fmt.Sprintf("waiting for dependencies to become Ready: %s", strings.Join(waiting, ", "))
+	if as.Status.Phase == apps.ChartAssignmentPhaseWaitingForDependencies &&
+		as.Status.ObservedGeneration == as.Generation &&
+		hasConditionMessage(as, apps.ChartAssignmentConditionSettled, msg) {
+		return nil
+	}
+	as.Status.ObservedGeneration = as.Generation
+	as.Status.Phase = apps.ChartAssignmentPhaseWaitingForDependencies
+	setCondition(as, apps.ChartAssignmentConditionSettled, core.ConditionFalse, msg)
 	return r.kube.Status().Update(ctx, as)
 }
 
@@ -473,6 +1138,17 @@ func inCondition(as *apps.ChartAssignment, c apps.ChartAssignmentConditionType)
 	return false
 }
 
+// hasConditionMessage returns true if the ChartAssignment has a condition of
+// the given type with the given message.
+func hasConditionMessage(as *apps.ChartAssignment, c apps.ChartAssignmentConditionType, msg string) bool {
+	for _, cond := range as.Status.Conditions {
+		if cond.Type == c {
+			return cond.Message == msg
+		}
+	}
+	return false
+}
+
 // setCondition adds or updates a condition. Existing conditions are detected
 // based on the Type field.
 func setCondition(as *apps.ChartAssignment, t apps.ChartAssignmentConditionType, v core.ConditionStatus, msg string) {
@@ -505,22 +1181,28 @@ func setCondition(as *apps.ChartAssignment, t apps.ChartAssignmentConditionType,
 }
 
 // NewValidationWebhook returns a new webhook that validates ChartAssignments.
-func NewValidationWebhook(mgr manager.Manager) *admission.Webhook {
-	return &admission.Webhook{Handler: newChartAssignmentValidator(mgr.GetScheme())}
+// System namespaces such as kube-system are only accepted in
+// allowedNamespaces if allowSystemNamespaces is set.
+func NewValidationWebhook(mgr manager.Manager, allowSystemNamespaces bool) *admission.Webhook {
+	v := newChartAssignmentValidator(mgr.GetScheme())
+	v.allowSystemNamespaces = allowSystemNamespaces
+	return &admission.Webhook{Handler: v}
 }
 
 // NewValidationWebhookForEdgeCluster returns a webhook that checks
 // ChartAssignments are valid and apply to a cluster with the given name.
-func NewValidationWebhookForEdgeCluster(mgr manager.Manager, clusterName string) *admission.Webhook {
+func NewValidationWebhookForEdgeCluster(mgr manager.Manager, clusterName string, allowSystemNamespaces bool) *admission.Webhook {
 	v := newChartAssignmentValidator(mgr.GetScheme())
 	v.clusterName = clusterName
+	v.allowSystemNamespaces = allowSystemNamespaces
 	return &admission.Webhook{Handler: v}
 }
 
 // chartAssignmentValidator implements a validation webhook.
 type chartAssignmentValidator struct {
-	decoder     runtime.Decoder
-	clusterName string
+	decoder               runtime.Decoder
+	clusterName           string
+	allowSystemNamespaces bool
 }
 
 func newChartAssignmentValidator(sc *runtime.Scheme) *chartAssignmentValidator {
@@ -546,6 +1228,13 @@ func (v *chartAssignmentValidator) Handle(_ context.Context, req admission.Reque
 	if err := v.validate(cur, old); err != nil {
 		return admission.Denied(err.Error())
 	}
+	// Only validate values if the chart changed to not fetch it on every
+	// metadata or status update and to not block deletion.
+	if cur.DeletionTimestamp == nil && (old == nil || !reflect.DeepEqual(cur.Spec.Chart, old.Spec.Chart)) {
+		if errs := ValidateValues(&cur.Spec.Chart, field.NewPath("spec", "chart", "values")); len(errs) > 0 {
+			return admission.Denied(errs.ToAggregate().Error())
+		}
+	}
 	return admission.Allowed("")
 }
 
@@ -583,5 +1272,147 @@ func (v *chartAssignmentValidator) validate(cur, old *apps.ChartAssignment) erro
 	} else if c.Repository == "" || c.Name == "" || c.Version == "" {
 		return fmt.Errorf("non-inline chart must be fully specified")
 	}
+	if rb := cur.Spec.Rollback; rb != nil && rb.DeadlineSeconds < 0 {
+		return fmt.Errorf("rollback deadline must not be negative")
+	}
+	for i, src := range c.ValuesFrom {
+		if err := ValidateValuesFrom(src); err != nil {
+			return fmt.Errorf("invalid valuesFrom[%d]: %s", i, err)
+		}
+	}
+	if errs := ValidateNamespace(cur.Spec.Namespace, field.NewPath("spec", "namespace")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if errs := ValidateAllowedNamespaces(cur.Spec.NamespaceName, cur.Spec.AllowedNamespaces, field.NewPath("spec", "allowedNamespaces")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if !v.allowSystemNamespaces {
+		if errs := ValidateNoSystemNamespaces(cur.Spec.AllowedNamespaces, field.NewPath("spec", "allowedNamespaces")); len(errs) > 0 {
+			return errs.ToAggregate()
+		}
+	}
+	if errs := ValidateDependsOn(cur.Name, cur.Spec.DependsOn, field.NewPath("spec", "dependsOn")); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	if ip := cur.Spec.ImagePull; ip != nil {
+		for i, reg := range ip.Registries {
+			if reg.Host == "" {
+				return fmt.Errorf("host missing for imagePull registry %d", i)
+			}
+			if reg.SecretName == "" {
+				continue
+			}
+			if errs := validation.NameIsDNSSubdomain(reg.SecretName, false); len(errs) > 0 {
+				return fmt.Errorf("invalid secret name %q: %s", reg.SecretName, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateNamespace validates the labels and annotations of a namespace
+// spec. The "app" label and the annotations that record managed keys are
+// reserved.
+func ValidateNamespace(n *apps.ChartAssignmentNamespace, fldPath *field.Path) field.ErrorList {
+	if n == nil {
+		return nil
+	}
+	errs := metavalidation.ValidateLabels(n.Labels, fldPath.Child("labels"))
+	if _, ok := n.Labels["app"]; ok {
+		errs = append(errs, field.Forbidden(fldPath.Child("labels").Key("app"), "label is reserved"))
+	}
+	errs = append(errs, validation.ValidateAnnotations(n.Annotations, fldPath.Child("annotations"))...)
+	for _, k := range []string{annotationManagedLabels, annotationManagedAnnotations} {
+		if _, ok := n.Annotations[k]; ok {
+			errs = append(errs, field.Forbidden(fldPath.Child("annotations").Key(k), "annotation is reserved"))
+		}
+	}
+	return errs
+}
+
+// ValidateAllowedNamespaces validates the names of the namespaces a chart may
+// create resources in besides its own namespace.
+func ValidateAllowedNamespaces(own string, allowed []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, ns := range allowed {
+		p := fldPath.Index(i)
+		if ns == own {
+			errs = append(errs, field.Invalid(p, ns, "must differ from the ChartAssignment's namespace"))
+		} else if seen[ns] {
+			errs = append(errs, field.Duplicate(p, ns))
+		}
+		for _, msg := range validation.ValidateNamespaceName(ns, false) {
+			errs = append(errs, field.Invalid(p, ns, msg))
+		}
+		seen[ns] = true
+	}
+	return errs
+}
+
+// systemNamespaces are namespaces that charts may only create resources in
+// if the operator allows it, as they are shared by the whole cluster.
+var systemNamespaces = map[string]bool{
+	"default":         true,
+	"kube-node-lease": true,
+	"kube-public":     true,
+	"kube-system":     true,
+}
+
+// ValidateNoSystemNamespaces rejects system namespaces such as kube-system
+// among the namespaces a chart may create resources in.
+func ValidateNoSystemNamespaces(allowed []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, ns := range allowed {
+		if systemNamespaces[ns] {
+			errs = append(errs, field.Forbidden(fldPath.Index(i), fmt.Sprintf("system namespace %q is not allowed", ns)))
+		}
+	}
+	return errs
+}
+
+// ValidateDependsOn validates the names of the resources a resource with the
+// given name depends on. It must not depend on itself.
+func ValidateDependsOn(own string, deps []string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, name := range deps {
+		p := fldPath.Index(i)
+		if name == own {
+			errs = append(errs, field.Invalid(p, name, "must not depend on itself"))
+		} else if seen[name] {
+			errs = append(errs, field.Duplicate(p, name))
+		}
+		for _, msg := range validation.NameIsDNSSubdomain(name, false) {
+			errs = append(errs, field.Invalid(p, name, msg))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+// ValidateValuesFrom checks that the valuesFrom source references a Secret or
+// ConfigMap and has a valid namespace and target path.
+func ValidateValuesFrom(src apps.ValuesFromSource) error {
+	switch src.Kind {
+	case apps.ValuesFromSourceSecret, apps.ValuesFromSourceConfigMap:
+	default:
+		return fmt.Errorf("kind must be %q or %q", apps.ValuesFromSourceSecret, apps.ValuesFromSourceConfigMap)
+	}
+	if src.Name == "" {
+		return fmt.Errorf("name missing")
+	}
+	if src.Namespace != "" {
+		if errs := validation.ValidateNamespaceName(src.Namespace, false); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace name %q: %s", src.Namespace, strings.Join(errs, ", "))
+		}
+	}
+	if src.TargetPath != "" {
+		for _, k := range strings.Split(src.TargetPath, ".") {
+			if k == "" {
+				return fmt.Errorf("invalid target path %q", src.TargetPath)
+			}
+		}
+	}
 	return nil
 }
@@ -15,10 +15,17 @@
 package chartassignment
 
 import (
+	"context"
+	"reflect"
 	"strings"
 	"testing"
 
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/helm/pkg/chartutil"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/yaml"
 )
 
@@ -165,6 +172,254 @@ spec:
   namespaceName: ns2
   chart:
     inline: abc
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-values-from",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+    valuesFrom:
+    - kind: Secret
+      name: s1
+      targetPath: a.b
+    - kind: ConfigMap
+      name: cm1
+      namespace: ns2
+      valuesKey: config.yaml
+      optional: true
+	`,
+		},
+		{
+			name: "values-from-invalid-kind",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+    valuesFrom:
+    - kind: Pod
+      name: p1
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "values-from-missing-name",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+    valuesFrom:
+    - kind: Secret
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "values-from-invalid-target-path",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+    valuesFrom:
+    - kind: Secret
+      name: s1
+      targetPath: a..b
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-image-pull",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  imagePull:
+    registries:
+    - host: eu.gcr.io
+    - host: registry.example.com:5000
+      secretName: example-registry
+	`,
+		},
+		{
+			name: "image-pull-missing-host",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  imagePull:
+    registries:
+    - secretName: example-registry
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-namespace",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  namespace:
+    labels:
+      pod-security.kubernetes.io/enforce: baseline
+    annotations:
+      example.com/owner: team-a
+    resourceQuota:
+      hard:
+        requests.cpu: "2"
+	`,
+		},
+		{
+			name: "namespace-invalid-label",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  namespace:
+    labels:
+      foo: "not a valid value"
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-allowed-namespaces",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [monitoring, logging]
+	`,
+		},
+		{
+			name: "allowed-namespaces-duplicate",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [monitoring, monitoring]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "allowed-namespaces-invalid-name",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [Monitoring]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "allowed-namespaces-kube-system",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [monitoring, kube-system]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "allowed-namespaces-default",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [default]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "allowed-namespaces-kube-public",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [kube-public]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "valid-depends-on",
+			cur: `
+metadata:
+  name: ca1
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  dependsOn: [ca2, ca3]
+	`,
+		},
+		{
+			name: "depends-on-itself",
+			cur: `
+metadata:
+  name: ca1
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  dependsOn: [ca1]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "depends-on-duplicate",
+			cur: `
+metadata:
+  name: ca1
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  dependsOn: [ca2, ca2]
+	`,
+			shouldFail: true,
+		},
+		{
+			name: "namespace-reserved-label",
+			cur: `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  namespace:
+    labels:
+      app: other
 	`,
 			shouldFail: true,
 		},
@@ -193,6 +448,23 @@ spec:
 	}
 }
 
+func TestValidate_allowSystemNamespaces(t *testing.T) {
+	cur := &apps.ChartAssignment{}
+	unmarshalYAML(t, cur, `
+spec:
+  clusterName: c1
+  namespaceName: ns1
+  chart:
+    inline: abc
+  allowedNamespaces: [kube-system, default]
+	`)
+	v := newChartAssignmentValidator(nil)
+	v.allowSystemNamespaces = true
+	if err := v.validate(cur, nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
 func TestValidateForOnPremCluster(t *testing.T) {
 	cases := []struct {
 		name       string
@@ -238,3 +510,353 @@ spec:
 		})
 	}
 }
+
+func TestParseValuesFrom(t *testing.T) {
+	cases := []struct {
+		name       string
+		data       string
+		targetPath string
+		want       chartutil.Values
+	}{
+		{
+			name: "values-file",
+			data: "a: 1\nb: {c: d}",
+			want: chartutil.Values{"a": 1, "b": map[string]interface{}{"c": "d"}},
+		},
+		{
+			name:       "target-path",
+			data:       "secret: data",
+			targetPath: "a.b",
+			want:       chartutil.Values{"a": map[string]interface{}{"b": "secret: data"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseValuesFrom([]byte(c.data), c.targetPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := c.want.YAML()
+			if have, _ := got.YAML(); have != want {
+				t.Errorf("unexpected values: want\n%s\ngot\n%s", want, have)
+			}
+		})
+	}
+}
+
+func TestRegistryHosts(t *testing.T) {
+	cases := []struct {
+		name   string
+		secret core.Secret
+		want   []string
+	}{
+		{
+			name: "dockercfg",
+			secret: core.Secret{
+				Type: core.SecretTypeDockercfg,
+				Data: map[string][]byte{
+					core.DockerConfigKey: []byte(`{"https://gcr.io": {}}`),
+				},
+			},
+			want: []string{"gcr.io"},
+		},
+		{
+			name: "dockerconfigjson",
+			secret: core.Secret{
+				Type: core.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					core.DockerConfigJsonKey: []byte(`{"auths": {"registry.example.com:5000/v1/": {}}}`),
+				},
+			},
+			want: []string{"registry.example.com:5000"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := registryHosts(&c.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("unexpected hosts: want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSetManaged(t *testing.T) {
+	m := map[string]string{"a": "1", "b": "2", "c": "3"}
+	// b was managed before but is no longer wanted, c is unmanaged.
+	got, managed := setManaged(m, map[string]string{"a": "4", "d": "5"}, "a,b")
+	want := map[string]string{"a": "4", "c": "3", "d": "5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	if managed != "a,d" {
+		t.Errorf("want managed keys %q, got %q", "a,d", managed)
+	}
+	got, managed = setManaged(nil, nil, "")
+	if len(got) != 0 || managed != "" {
+		t.Errorf("want no keys, got %v (%q)", got, managed)
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	cases := []struct {
+		name string
+		cur  string
+		want bool
+	}{
+		{
+			name: "no-dependencies",
+			cur: `
+metadata:
+  generation: 2
+spec:
+  chart:
+    inline: abc
+	`,
+			want: false,
+		},
+		{
+			name: "new-generation",
+			cur: `
+metadata:
+  generation: 2
+spec:
+  dependsOn: [ca2]
+status:
+  observedGeneration: 1
+  phase: Ready
+	`,
+			want: true,
+		},
+		{
+			name: "still-waiting",
+			cur: `
+metadata:
+  generation: 2
+spec:
+  dependsOn: [ca2]
+status:
+  observedGeneration: 2
+  phase: WaitingForDependencies
+	`,
+			want: true,
+		},
+		{
+			name: "already-applied",
+			cur: `
+metadata:
+  generation: 2
+spec:
+  dependsOn: [ca2]
+status:
+  observedGeneration: 2
+  phase: Updating
+	`,
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var as apps.ChartAssignment
+			unmarshalYAML(t, &as, c.cur)
+			if got := waitForDependencies(&as); got != c.want {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestDependencyReady(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+spec:
+  clusterName: robot1
+`)
+	cases := []struct {
+		name string
+		dep  string
+		want bool
+	}{
+		{
+			name: "ready",
+			dep: `
+metadata:
+  generation: 3
+spec:
+  clusterName: robot1
+status:
+  observedGeneration: 3
+  phase: Ready
+	`,
+			want: true,
+		},
+		{
+			name: "settled",
+			dep: `
+metadata:
+  generation: 3
+spec:
+  clusterName: robot1
+status:
+  observedGeneration: 3
+  phase: Settled
+	`,
+			want: false,
+		},
+		{
+			name: "ready-for-old-generation",
+			dep: `
+metadata:
+  generation: 3
+spec:
+  clusterName: robot1
+status:
+  observedGeneration: 2
+  phase: Ready
+	`,
+			want: false,
+		},
+		{
+			name: "other-cluster",
+			dep: `
+metadata:
+  generation: 3
+spec:
+  clusterName: robot2
+status:
+  observedGeneration: 3
+  phase: Ready
+	`,
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var dep apps.ChartAssignment
+			unmarshalYAML(t, &dep, c.dep)
+			if got := dependencyReady(&as, &dep); got != c.want {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestReconcile_paused(t *testing.T) {
+	// The fake client decodes objects with the client-go scheme.
+	if err := apps.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name          string
+		cur           string
+		wantPhase     apps.ChartAssignmentPhase
+		wantUnchanged bool
+	}{
+		{
+			name: "newly-paused",
+			cur: `
+metadata:
+  name: foo
+  generation: 3
+spec:
+  clusterName: robot1
+  namespaceName: app-foo
+  paused: true
+  chart:
+    inline: abc
+status:
+  observedGeneration: 2
+  phase: Ready
+	`,
+			wantPhase: apps.ChartAssignmentPhasePaused,
+		},
+		{
+			name: "already-paused",
+			cur: `
+metadata:
+  name: foo
+  generation: 3
+spec:
+  clusterName: robot1
+  namespaceName: app-foo
+  paused: true
+  chart:
+    inline: abc
+status:
+  observedGeneration: 3
+  phase: Paused
+	`,
+			wantPhase:     apps.ChartAssignmentPhasePaused,
+			wantUnchanged: true,
+		},
+		{
+			name: "paused-with-changed-spec",
+			cur: `
+metadata:
+  name: foo
+  generation: 4
+spec:
+  clusterName: robot1
+  namespaceName: app-foo
+  paused: true
+  chart:
+    inline: abcd
+status:
+  observedGeneration: 3
+  phase: Paused
+	`,
+			wantPhase: apps.ChartAssignmentPhasePaused,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var as apps.ChartAssignment
+			unmarshalYAML(t, &as, c.cur)
+			kube := fake.NewFakeClientWithScheme(scheme.Scheme, &as)
+			r := &Reconciler{kube: kube, cluster: "robot1"}
+
+			var before apps.ChartAssignment
+			if err := kube.Get(context.Background(), kclient.ObjectKey{Name: "foo"}, &before); err != nil {
+				t.Fatal(err)
+			}
+			res, err := r.reconcile(context.Background(), before.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Requeue || res.RequeueAfter != 0 {
+				t.Errorf("paused ChartAssignment was requeued: %+v", res)
+			}
+
+			var got apps.ChartAssignment
+			if err := kube.Get(context.Background(), kclient.ObjectKey{Name: "foo"}, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != c.wantPhase {
+				t.Errorf("want phase %q, got %q", c.wantPhase, got.Status.Phase)
+			}
+			if got.Status.ObservedGeneration != got.Generation {
+				t.Errorf("want observed generation %d, got %d", got.Generation, got.Status.ObservedGeneration)
+			}
+			if c.wantUnchanged && got.ResourceVersion != before.ResourceVersion {
+				t.Errorf("status was updated although it didn't change")
+			}
+			if !c.wantUnchanged {
+				cond := got.Status.Conditions
+				if len(cond) != 1 || cond[0].Type != apps.ChartAssignmentConditionSettled || cond[0].Status != core.ConditionFalse {
+					t.Errorf("want Settled=False condition, got %+v", cond)
+				}
+			}
+			// The app must be left alone, so its namespace isn't created.
+			var nss core.NamespaceList
+			if err := kube.List(context.Background(), &nss); err != nil {
+				t.Fatal(err)
+			}
+			if len(nss.Items) > 0 {
+				t.Errorf("namespace of paused ChartAssignment was created")
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/helm/pkg/chartutil"
+
+	chartv3 "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	chartutilv3 "helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// expandChartV3 renders a chart with apiVersion v2 with Helm 3. Dependencies
+// declared in Chart.yaml must be packaged in the charts/ directory. The
+// values are validated against the chart's values.schema.json, if any.
+// Files in the crds/ directory are returned along with the templates.
+func expandChartV3(as *apps.ChartAssignment, archive []byte, caps *chartutilv3.Capabilities, valuesFrom ...chartutil.Values) (map[string]string, error) {
+	c, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "load chart archive")}
+	}
+	if c.Metadata.Type == "library" {
+		return nil, &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Errorf("library chart %q is not installable", c.Name())}
+	}
+	if err := checkDependenciesV3(c); err != nil {
+		return nil, &stageError{stage: apps.ChartAssignmentStageDependencies, err: errors.Wrap(err, "check chart dependencies")}
+	}
+
+	// The chart's default values are coalesced by ToRenderValues below.
+	vals := chartutilv3.Values{}
+	for _, v := range valuesFrom {
+		mergeValuesV3(vals, v) // Values from Secrets and ConfigMaps.
+	}
+	mergeValuesV3(vals, as.Spec.Chart.Values) // ChartAssignment values.
+
+	// Drop disabled dependencies and import values from enabled ones.
+	if err := chartutilv3.ProcessDependencies(c, vals); err != nil {
+		return nil, &stageError{stage: apps.ChartAssignmentStageDependencies, err: errors.Wrap(err, "process chart dependencies")}
+	}
+	if caps == nil {
+		caps = chartutilv3.DefaultCapabilities
+	}
+	renderVals, err := chartutilv3.ToRenderValues(c, vals, chartutilv3.ReleaseOptions{
+		Name:      as.Name,
+		Namespace: as.Spec.NamespaceName,
+		Revision:  1,
+		IsInstall: true,
+	}, caps)
+	if err != nil {
+		return nil, &stageError{stage: apps.ChartAssignmentStageValidate, err: errors.Wrap(err, "validate values")}
+	}
+	manifests, err := engine.Render(c, renderVals)
+	if err != nil {
+		return nil, newRenderError(errors.Wrap(err, "render chart"))
+	}
+	for _, crd := range c.CRDObjects() {
+		manifests[crd.Filename] = string(crd.File.Data)
+	}
+	return manifests, nil
+}
+
+// checkDependenciesV3 ensures that the dependencies in Chart.yaml are
+// actually packaged in.
+func checkDependenciesV3(c *chartv3.Chart) error {
+	var missing []string
+outer:
+	for _, r := range c.Metadata.Dependencies {
+		for _, d := range c.Dependencies() {
+			if d.Name() == r.Name {
+				continue outer
+			}
+		}
+		missing = append(missing, r.Name)
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("found in Chart.yaml, but missing in charts/ directory: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// mergeValuesV3 recursively merges src into dst, with src taking precedence.
+// It is the Helm 3 equivalent of chartutil.Values.MergeInto.
+func mergeValuesV3(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sv, sok := v.(map[string]interface{})
+		dv, dok := dst[k].(map[string]interface{})
+		if sok && dok {
+			mergeValuesV3(dv, sv)
+			continue
+		}
+		if sok {
+			// Copy to not modify src when merging further values into it.
+			dv = map[string]interface{}{}
+			mergeValuesV3(dv, sv)
+			dst[k] = dv
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// capabilitiesTTL is how long discovered capabilities are reused before the
+// cluster is queried again, e.g. to pick up newly installed CRDs.
+const capabilitiesTTL = 5 * time.Minute
+
+// capabilitiesCache caches the capabilities discovered from the cluster, so
+// that rendering charts doesn't query the API server's discovery endpoints
+// on every update. Failed discoveries are not cached.
+type capabilitiesCache struct {
+	discovery discovery.DiscoveryInterface
+	ttl       time.Duration
+	now       func() time.Time
+
+	mtx     sync.Mutex
+	caps    *chartutilv3.Capabilities
+	updated time.Time
+}
+
+func newCapabilitiesCache(dc discovery.DiscoveryInterface) *capabilitiesCache {
+	return &capabilitiesCache{discovery: dc, ttl: capabilitiesTTL, now: time.Now}
+}
+
+// get returns the cached capabilities or discovers them if they are missing
+// or expired.
+func (c *capabilitiesCache) get() (*chartutilv3.Capabilities, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	if c.caps != nil && now.Sub(c.updated) < c.ttl {
+		return c.caps, nil
+	}
+	caps, err := discoverCapabilities(c.discovery)
+	if err != nil {
+		c.caps = nil
+		return nil, err
+	}
+	c.caps, c.updated = caps, now
+	return caps, nil
+}
+
+// capabilities returns the Kubernetes version and API versions of the
+// cluster for rendering charts with Helm 3. If they cannot be discovered,
+// Helm's defaults are used.
+func (r *release) capabilities() *chartutilv3.Capabilities {
+	if r.caps == nil {
+		return nil
+	}
+	caps, err := r.caps.get()
+	if err != nil {
+		log.Printf("Failed to discover capabilities for %q, using defaults: %s", r.name, err)
+		return nil
+	}
+	return caps
+}
+
+func discoverCapabilities(dc discovery.DiscoveryInterface) (*chartutilv3.Capabilities, error) {
+	kv, err := dc.ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "get server version")
+	}
+	groups, resources, err := dc.ServerGroupsAndResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "get server resources")
+	}
+	// Like Helm, include both group versions and resource kinds, e.g.
+	// "apps/v1" and "apps/v1/Deployment".
+	var versions chartutilv3.VersionSet
+	for _, g := range groups {
+		for _, gv := range g.Versions {
+			versions = append(versions, gv.GroupVersion)
+		}
+	}
+	for _, rl := range resources {
+		for _, r := range rl.APIResources {
+			versions = append(versions, fmt.Sprintf("%s/%s", rl.GroupVersion, r.Kind))
+		}
+	}
+	return &chartutilv3.Capabilities{
+		KubeVersion: chartutilv3.KubeVersion{
+			Version: kv.GitVersion,
+			Major:   kv.Major,
+			Minor:   kv.Minor,
+		},
+		APIVersions: versions,
+	}, nil
+}
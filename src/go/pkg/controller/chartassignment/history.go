@@ -0,0 +1,152 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	// Labels of the Secrets holding the manifest history of a
+	// ChartAssignment.
+	LabelManifestsChartAssignment = "cloudrobotics.com/chartassignment"
+	LabelManifestsGeneration      = "cloudrobotics.com/generation"
+	// ManifestsKey is the key of the gzipped manifests in the Secrets.
+	ManifestsKey = "manifests.yaml.gz"
+
+	DefaultManifestHistory = 5
+)
+
+// manifestsSecretName returns the name of the Secret holding the manifests
+// of the given generation.
+func manifestsSecretName(as string, generation int64) string {
+	return fmt.Sprintf("%s-manifests-%d", as, generation)
+}
+
+// encodeManifests returns the resources as a gzipped multi-document YAML.
+func encodeManifests(resources []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, r := range resources {
+		b, err := sigsyaml.Marshal(r.Object)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal %s %q", r.GetKind(), r.GetName())
+		}
+		fmt.Fprintln(zw, "---")
+		zw.Write(b)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeManifests returns the manifests stored in a Secret of the manifest
+// history.
+func DecodeManifests(s *core.Secret) ([]byte, error) {
+	data, ok := s.Data[ManifestsKey]
+	if !ok {
+		return nil, errors.Errorf("Secret %s/%s has no key %q", s.Namespace, s.Name, ManifestsKey)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "decompress manifests")
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// SortManifestHistory sorts Secrets of the manifest history by generation,
+// newest first.
+func SortManifestHistory(secrets []core.Secret) {
+	generation := func(s *core.Secret) int64 {
+		g, _ := strconv.ParseInt(s.Labels[LabelManifestsGeneration], 10, 64)
+		return g
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return generation(&secrets[i]) > generation(&secrets[j])
+	})
+}
+
+// storeManifests stores the resources applied for the ChartAssignment's
+// generation in a Secret and deletes all but the newest depth Secrets.
+func storeManifests(kube kubernetes.Interface, as *apps.ChartAssignment, resources []*unstructured.Unstructured, depth int) (*apps.ChartAssignmentManifests, error) {
+	data, err := encodeManifests(resources)
+	if err != nil {
+		return nil, err
+	}
+	_true := true
+	s := &core.Secret{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      manifestsSecretName(as.Name, as.Generation),
+			Namespace: as.Spec.NamespaceName,
+			Labels: map[string]string{
+				LabelManifestsChartAssignment: as.Name,
+				LabelManifestsGeneration:      strconv.FormatInt(as.Generation, 10),
+			},
+			OwnerReferences: []meta.OwnerReference{{
+				APIVersion:         chartAssignmentKind.GroupVersion().String(),
+				Kind:               chartAssignmentKind.Kind,
+				Name:               as.Name,
+				UID:                as.UID,
+				BlockOwnerDeletion: &_true,
+			}},
+		},
+		Type: core.SecretTypeOpaque,
+		Data: map[string][]byte{ManifestsKey: data},
+	}
+	// A generation is applied again on retries or when its values from
+	// Secrets and ConfigMaps change. Keep the latest manifests.
+	secrets := kube.CoreV1().Secrets(s.Namespace)
+	if _, err := secrets.Create(s); k8serrors.IsAlreadyExists(err) {
+		if _, err := secrets.Update(s); err != nil {
+			return nil, errors.Wrapf(err, "update Secret %q", s.Name)
+		}
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "create Secret %q", s.Name)
+	}
+
+	list, err := secrets.List(meta.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", LabelManifestsChartAssignment, as.Name),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list manifest history")
+	}
+	SortManifestHistory(list.Items)
+	for i := depth; i < len(list.Items); i++ {
+		err := secrets.Delete(list.Items[i].Name, &meta.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "delete Secret %q", list.Items[i].Name)
+		}
+	}
+	return &apps.ChartAssignmentManifests{
+		Generation: as.Generation,
+		SecretName: s.Name,
+	}, nil
+}
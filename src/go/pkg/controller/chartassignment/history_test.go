@@ -0,0 +1,83 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"strings"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreManifests(t *testing.T) {
+	kube := fake.NewSimpleClientset()
+
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  namespaceName: app-test
+	`)
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName("foo")
+
+	for gen := int64(1); gen <= 4; gen++ {
+		as.Generation = gen
+		m, err := storeManifests(kube, &as, []*unstructured.Unstructured{cm}, 2)
+		if err != nil {
+			t.Fatalf("generation %d: unexpected error: %s", gen, err)
+		}
+		if m.Generation != gen || m.SecretName != manifestsSecretName(as.Name, gen) {
+			t.Errorf("generation %d: unexpected manifests reference %+v", gen, m)
+		}
+	}
+	// Re-applying a generation updates its manifests.
+	cm.SetName("bar")
+	if _, err := storeManifests(kube, &as, []*unstructured.Unstructured{cm}, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	list, err := kube.CoreV1().Secrets("app-test").List(meta.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortManifestHistory(list.Items)
+	var names []string
+	for _, s := range list.Items {
+		names = append(names, s.Name)
+	}
+	if want := "test-assignment-1-manifests-4,test-assignment-1-manifests-3"; strings.Join(names, ",") != want {
+		t.Fatalf("want Secrets %s, got %s", want, strings.Join(names, ","))
+	}
+	manifests, err := DecodeManifests(&list.Items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: bar
+`
+	if string(manifests) != want {
+		t.Errorf("want manifests\n%s\ngot\n%s", want, manifests)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"context"
+	"log"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The controller-runtime already provides metrics for reconcile latency and
+// the work queue. These are specific to charts.
+var (
+	chartFetchDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "chartassignment_chart_fetch_duration_seconds",
+			Help:    "Duration of downloading charts from their repository",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		},
+	)
+	chartFetchFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "chartassignment_chart_fetch_failures_total",
+			Help: "Number of failed downloads of charts from their repository",
+		},
+	)
+	applyDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "chartassignment_apply_duration_seconds",
+			Help:    "Duration of applying the resources of charts, by result",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+		},
+		[]string{"result"},
+	)
+	chartAssignmentsDesc = prometheus.NewDesc(
+		"chartassignments",
+		"Number of ChartAssignments, by phase",
+		[]string{"phase"}, nil,
+	)
+)
+
+// phases are all phases that are reported, even if no ChartAssignment is in
+// them, so that dashboards don't have gaps.
+var phases = []apps.ChartAssignmentPhase{
+	apps.ChartAssignmentPhaseAccepted,
+	apps.ChartAssignmentPhaseLoadingChart,
+	apps.ChartAssignmentPhaseInstalling,
+	apps.ChartAssignmentPhaseUpdating,
+	apps.ChartAssignmentPhaseDeleting,
+	apps.ChartAssignmentPhaseSettled,
+	apps.ChartAssignmentPhaseDeleted,
+	apps.ChartAssignmentPhaseFailed,
+	apps.ChartAssignmentPhaseReady,
+	apps.ChartAssignmentPhasePaused,
+	apps.ChartAssignmentPhaseWaitingForDependencies,
+}
+
+func init() {
+	metrics.Registry.MustRegister(chartFetchDuration)
+	metrics.Registry.MustRegister(chartFetchFailures)
+	metrics.Registry.MustRegister(applyDuration)
+}
+
+// phaseCollector counts the ChartAssignments in the cache by phase when
+// metrics are collected. In the cloud cluster, this includes the
+// ChartAssignments of all robots.
+type phaseCollector struct {
+	kube kclient.Reader
+}
+
+func (c *phaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- chartAssignmentsDesc
+}
+
+func (c *phaseCollector) Collect(ch chan<- prometheus.Metric) {
+	var cas apps.ChartAssignmentList
+	if err := c.kube.List(context.Background(), &cas); err != nil {
+		log.Printf("Failed to list ChartAssignments for metrics: %s", err)
+		return
+	}
+	counts := countPhases(cas.Items)
+	for _, p := range phases {
+		ch <- prometheus.MustNewConstMetric(chartAssignmentsDesc, prometheus.GaugeValue, float64(counts[p]), string(p))
+	}
+}
+
+// countPhases counts the ChartAssignments by phase. ChartAssignments whose
+// status was not set yet are counted as Accepted.
+func countPhases(cas []apps.ChartAssignment) map[apps.ChartAssignmentPhase]int {
+	counts := map[apps.ChartAssignmentPhase]int{}
+	for _, ca := range cas {
+		p := ca.Status.Phase
+		if p == "" {
+			p = apps.ChartAssignmentPhaseAccepted
+		}
+		counts[p]++
+	}
+	return counts
+}
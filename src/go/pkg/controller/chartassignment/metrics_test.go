@@ -0,0 +1,39 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"reflect"
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+)
+
+func TestCountPhases(t *testing.T) {
+	cas := make([]apps.ChartAssignment, 4)
+	cas[0].Status.Phase = apps.ChartAssignmentPhaseLoadingChart
+	cas[1].Status.Phase = apps.ChartAssignmentPhaseLoadingChart
+	cas[2].Status.Phase = apps.ChartAssignmentPhaseReady
+	// cas[3] has no status yet.
+
+	want := map[apps.ChartAssignmentPhase]int{
+		apps.ChartAssignmentPhaseLoadingChart: 2,
+		apps.ChartAssignmentPhaseReady:        1,
+		apps.ChartAssignmentPhaseAccepted:     1,
+	}
+	if got := countPhases(cas); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
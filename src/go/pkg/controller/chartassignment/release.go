@@ -15,23 +15,34 @@
 package chartassignment
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
 	"github.com/googlecloudrobotics/core/src/go/pkg/synk"
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/helm/pkg/chartutil"
@@ -41,36 +52,76 @@ import (
 	"k8s.io/helm/pkg/proto/hapi/chart"
 	"k8s.io/helm/pkg/renderutil"
 	"k8s.io/helm/pkg/repo"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	chartv3 "helm.sh/helm/v3/pkg/chart"
+	chartutilv3 "helm.sh/helm/v3/pkg/chartutil"
 )
 
 // releases is a cache of releases currently handled.
 type releases struct {
 	recorder record.EventRecorder
 	synk     synk.Interface
+	caps     *capabilitiesCache
+	kube     kubernetes.Interface
+	events   chan<- event.GenericEvent
+	// manifestHistory is the number of generations whose manifests are
+	// kept. Zero disables the history.
+	manifestHistory int
 
 	mtx sync.Mutex
 	m   map[string]*release
 }
 
-func newReleases(cfg *rest.Config, rec record.EventRecorder) (*releases, error) {
+// newReleases returns a new release cache. Events for ChartAssignments are
+// sent on the given channel when their release finished an update or
+// deletion.
+func newReleases(cfg *rest.Config, rec record.EventRecorder, events chan<- event.GenericEvent) (*releases, error) {
 	synk, err := synk.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &releases{
 		recorder: rec,
 		m:        map[string]*release{},
 		synk:     synk,
+		caps:     newCapabilitiesCache(dc),
+		kube:     kube,
+		events:   events,
 	}, nil
 }
 
 // release is a cache object which acts as a proxy for Synk ResourceSets.
 type release struct {
-	name       string
-	synk       synk.Interface
-	recorder   record.EventRecorder
-	actorc     chan func()
-	generation int64 // last deployed generation.
+	name     string
+	synk     synk.Interface
+	caps     *capabilitiesCache
+	kube     kubernetes.Interface
+	recorder record.EventRecorder
+	events   chan<- event.GenericEvent
+	actorc   chan func()
+	// manifestHistory is the number of generations whose manifests are
+	// kept. Zero disables the history.
+	manifestHistory int
+	generation      int64              // last deployed generation.
+	valuesFrom      []chartutil.Values // last deployed values from valuesFrom sources.
+	updated         time.Time          // time at which the last deployed generation was first applied.
+
+	// lastReady is the last generation of the ChartAssignment that reached
+	// the Ready phase. It is re-applied together with lastReadyValuesFrom
+	// when a failed update is rolled back. The ChartAssignment's status
+	// keeps it across restarts, see restoreLastReady.
+	lastReady           *apps.ChartAssignment
+	lastReadyValuesFrom []chartutil.Values
 
 	mtx    sync.Mutex
 	status releaseStatus
@@ -80,8 +131,81 @@ type releaseStatus struct {
 	phase apps.ChartAssignmentPhase
 	err   error // last encountered error
 	retry bool  // whether deployment should be retried.
+	// rollback is set if the last deployed generation was replaced by the
+	// last Ready generation.
+	rollback *apps.ChartAssignmentRollbackStatus
+	// failure describes the last encountered error if it occurred while
+	// updating the chart.
+	failure *apps.ChartAssignmentFailure
+	// manifests references the last applied manifests.
+	manifests *apps.ChartAssignmentManifests
+}
+
+// stageError is an error that occurred at a stage of updating a chart.
+type stageError struct {
+	stage     apps.ChartAssignmentStage
+	template  string
+	line      int
+	resources []apps.ChartAssignmentFailedResource
+	err       error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Cause() error  { return e.err }
+
+// failure returns the status description of the error.
+func (e *stageError) failure() *apps.ChartAssignmentFailure {
+	return &apps.ChartAssignmentFailure{
+		Stage:     e.stage,
+		Message:   e.err.Error(),
+		Template:  e.template,
+		Line:      e.line,
+		Resources: e.resources,
+	}
 }
 
+// templateErrRegexp matches the location in Go template errors, e.g.
+// "template: mychart/templates/deployment.yaml:12:20: executing ..." or
+// Helm 3 parse errors, e.g. "parse error at (mychart/templates/job.yaml:3): ...".
+var templateErrRegexp = regexp.MustCompile(`(?:template: |parse error at \()([^:\s()]+):(\d+)`)
+
+// newRenderError returns a stageError for an error from rendering a chart
+// with the failing template and line extracted from the error message.
+func newRenderError(err error) *stageError {
+	e := &stageError{stage: apps.ChartAssignmentStageRender, err: err}
+	if m := templateErrRegexp.FindStringSubmatch(err.Error()); m != nil {
+		e.template = m[1]
+		e.line, _ = strconv.Atoi(m[2])
+	}
+	return e
+}
+
+// newApplyError returns a stageError for an error from applying the
+// resources with the failed resources taken from the ResourceSet.
+func newApplyError(err error, rs *apps.ResourceSet) *stageError {
+	e := &stageError{stage: apps.ChartAssignmentStageApply, err: err}
+	if rs == nil {
+		return e
+	}
+	for _, g := range rs.Status.Failed {
+		for _, r := range g.Items {
+			e.resources = append(e.resources, apps.ChartAssignmentFailedResource{
+				Group:     g.Group,
+				Version:   g.Version,
+				Kind:      g.Kind,
+				Namespace: r.Namespace,
+				Name:      r.Name,
+				Error:     r.Error,
+			})
+		}
+	}
+	return e
+}
+
+// Time a new generation has to become Ready before it is rolled back, unless
+// the ChartAssignment specifies a deadline.
+const defaultRollbackDeadline = 10 * time.Minute
+
 // status returns the current phase and error of the release. ok is false
 // if the release does not exist in the cache.
 func (rs *releases) status(name string) (releaseStatus, bool) {
@@ -108,8 +232,13 @@ func (rs *releases) add(name string) *release {
 	r = &release{
 		name:     name,
 		synk:     rs.synk,
+		caps:     rs.caps,
+		kube:     rs.kube,
 		recorder: rs.recorder,
+		events:   rs.events,
 		actorc:   make(chan func()),
+
+		manifestHistory: rs.manifestHistory,
 	}
 	r.status.phase = apps.ChartAssignmentPhaseAccepted
 	rs.m[name] = r
@@ -119,23 +248,135 @@ func (rs *releases) add(name string) *release {
 }
 
 // ensureUpdated ensures that the ChartAssignment is installed as a Synk
-// ResourceSet.
+// ResourceSet. The valuesFrom are the values loaded from the chart's
+// valuesFrom sources in the order they are listed.
 // It returns true if it could initiate an update successfully.
-func (rs *releases) ensureUpdated(as *apps.ChartAssignment) bool {
+func (rs *releases) ensureUpdated(as *apps.ChartAssignment, valuesFrom []chartutil.Values) bool {
 	r := rs.add(as.Name)
 	status, _ := rs.status(as.Name)
 
 	// If the last generation we deployed matches the provided one, there's
 	// nothing to do. Unless the previous update set the retry flag due to
-	// a transient error.
+	// a transient error or a referenced Secret or ConfigMap changed.
 	// For a fresh release object, a first update will always happen as
 	// r.generation is 0 and resource generations start at 1.
-	if r.generation == as.Generation && !status.retry {
+	if r.generation == as.Generation && reflect.DeepEqual(r.valuesFrom, valuesFrom) && !status.retry {
 		return true
 	}
-	started := r.start(func() { r.update(as) })
-	if started {
+	// A rolled back generation is replaced by the last Ready generation
+	// until the ChartAssignment changes again.
+	target, targetValuesFrom := as, valuesFrom
+	if rb := status.rollback; rb != nil && rb.FailedGeneration == as.Generation {
+		target, targetValuesFrom = r.lastReady, r.lastReadyValuesFrom
+	}
+	started := r.start(func() { r.update(target, targetValuesFrom...) })
+	if !started {
+		return false
+	}
+	if r.generation != as.Generation {
 		r.generation = as.Generation
+		r.updated = time.Now()
+		// A rollback restored from the status still applies to the
+		// first update after a restart.
+		if rb := status.rollback; rb == nil || rb.FailedGeneration != as.Generation {
+			r.setRollback(nil)
+		}
+	}
+	r.valuesFrom = valuesFrom
+	return true
+}
+
+// setReady records the ChartAssignment as the last generation that reached
+// the Ready phase. It returns false if the Ready resources belong to the
+// last Ready generation because the current one was rolled back.
+func (rs *releases) setReady(as *apps.ChartAssignment) bool {
+	r := rs.add(as.Name)
+	status, _ := rs.status(as.Name)
+
+	// While rolled back, the Ready resources belong to r.lastReady.
+	if rb := status.rollback; rb != nil && rb.FailedGeneration == as.Generation {
+		return false
+	}
+	if r.lastReady == nil || r.lastReady.Generation != as.Generation {
+		r.lastReady = as.DeepCopy()
+	}
+	r.lastReadyValuesFrom = r.valuesFrom
+	return true
+}
+
+// restoreLastReady restores the last Ready generation and an ongoing
+// rollback from the ChartAssignment's status if the release doesn't know
+// them, e.g. because the controller restarted. The values of the last Ready
+// generation's valuesFrom sources are read again with loadValuesFrom.
+func (rs *releases) restoreLastReady(as *apps.ChartAssignment, loadValuesFrom func(*apps.ChartAssignment) ([]chartutil.Values, error)) error {
+	r := rs.add(as.Name)
+	if r.lastReady != nil || as.Status.LastReady == nil {
+		return nil
+	}
+	last := as.DeepCopy()
+	last.Generation = as.Status.LastReady.Generation
+	last.Spec = *as.Status.LastReady.Spec.DeepCopy()
+	last.Status = apps.ChartAssignmentStatus{}
+	valuesFrom, err := loadValuesFrom(last)
+	if err != nil {
+		return err
+	}
+	r.lastReady, r.lastReadyValuesFrom = last, valuesFrom
+
+	if rb := as.Status.Rollback; rb != nil && rb.FailedGeneration == as.Generation && rb.RestoredGeneration == last.Generation {
+		r.setRollback(rb.DeepCopy())
+	}
+	return nil
+}
+
+// ensureRolledBack re-applies the last Ready generation of the ChartAssignment
+// if rollback is enabled and the current generation failed or did not become
+// Ready within the deadline. The phase is the current phase of the
+// ChartAssignment.
+// It returns true if it initiated a rollback.
+func (rs *releases) ensureRolledBack(as *apps.ChartAssignment, phase apps.ChartAssignmentPhase) bool {
+	if as.Spec.Rollback == nil || as.DeletionTimestamp != nil {
+		return false
+	}
+	r := rs.add(as.Name)
+	status, _ := rs.status(as.Name)
+
+	if r.lastReady == nil || r.lastReady.Generation == as.Generation {
+		// Nothing to roll back to.
+		return false
+	}
+	if status.rollback != nil || r.generation != as.Generation {
+		// Already rolled back or the current generation wasn't deployed yet.
+		return false
+	}
+	deadline := defaultRollbackDeadline
+	if s := as.Spec.Rollback.DeadlineSeconds; s > 0 {
+		deadline = time.Duration(s) * time.Second
+	}
+	var reason string
+	switch {
+	case phase == apps.ChartAssignmentPhaseReady:
+		return false
+	case phase == apps.ChartAssignmentPhaseFailed && status.err != nil:
+		reason = status.err.Error()
+	case time.Since(r.updated) > deadline:
+		reason = fmt.Sprintf("not ready after %s", deadline)
+	default:
+		return false
+	}
+	last, lastValuesFrom := r.lastReady, r.lastReadyValuesFrom
+	started := r.start(func() {
+		r.recorder.Eventf(as, core.EventTypeWarning, "Rollback",
+			"rolling back to generation %d: %s", last.Generation, reason)
+		r.update(last, lastValuesFrom...)
+	})
+	if started {
+		r.setRollback(&apps.ChartAssignmentRollbackStatus{
+			FailedGeneration:   as.Generation,
+			RestoredGeneration: last.Generation,
+			Time:               meta.Now(),
+			Reason:             reason,
+		})
 	}
 	return started
 }
@@ -151,7 +392,23 @@ func (rs *releases) ensureDeleted(as *apps.ChartAssignment) bool {
 func (r *release) run() {
 	for f := range r.actorc {
 		f()
+		r.notify()
+	}
+}
+
+// notify triggers reconciliation of the ChartAssignment after the release
+// reached a new phase. Retries are left to the regular requeue to not retry
+// transient errors in a tight loop.
+func (r *release) notify() {
+	r.mtx.Lock()
+	retry := r.status.retry
+	r.mtx.Unlock()
+
+	if r.events == nil || retry {
+		return
 	}
+	as := &apps.ChartAssignment{ObjectMeta: meta.ObjectMeta{Name: r.name}}
+	r.events <- event.GenericEvent{Meta: as, Object: as}
 }
 
 // start tries to launch f on the worker goroutine.
@@ -169,10 +426,23 @@ func (r *release) setPhase(p apps.ChartAssignmentPhase) {
 	r.mtx.Lock()
 	r.status.phase = p
 	r.status.err = nil
+	r.status.failure = nil
 	r.status.retry = false
 	r.mtx.Unlock()
 }
 
+func (r *release) setRollback(rb *apps.ChartAssignmentRollbackStatus) {
+	r.mtx.Lock()
+	r.status.rollback = rb
+	r.mtx.Unlock()
+}
+
+func (r *release) setManifests(m *apps.ChartAssignmentManifests) {
+	r.mtx.Lock()
+	r.status.manifests = m
+	r.mtx.Unlock()
+}
+
 func (r *release) setFailed(err error, retry bool) {
 	r.mtx.Lock()
 	if !retry {
@@ -183,6 +453,10 @@ func (r *release) setFailed(err error, retry bool) {
 		r.status.phase = apps.ChartAssignmentPhaseFailed
 	}
 	r.status.err = err
+	r.status.failure = nil
+	if se, ok := err.(*stageError); ok {
+		r.status.failure = se.failure()
+	}
 	r.status.retry = retry
 	r.mtx.Unlock()
 }
@@ -209,9 +483,9 @@ func (r *release) delete(as *apps.ChartAssignment) {
 	r.generation = 0
 }
 
-func (r *release) update(as *apps.ChartAssignment) {
+func (r *release) update(as *apps.ChartAssignment, valuesFrom ...chartutil.Values) {
 	r.setPhase(apps.ChartAssignmentPhaseLoadingChart)
-	resources, retry, err := loadAndExpandChart(as)
+	resources, retry, err := loadAndExpandChart(as, r.capabilities(), valuesFrom...)
 	if err != nil {
 		r.recorder.Event(as, core.EventTypeWarning, "Failure", err.Error())
 		r.setFailed(err, retry)
@@ -222,8 +496,9 @@ func (r *release) update(as *apps.ChartAssignment) {
 	r.recorder.Event(as, core.EventTypeNormal, "UpdateChart", "update chart")
 
 	opts := &synk.ApplyOptions{
-		Namespace:        as.Spec.NamespaceName,
-		EnforceNamespace: true,
+		Namespace:         as.Spec.NamespaceName,
+		EnforceNamespace:  true,
+		AllowedNamespaces: as.Spec.AllowedNamespaces,
 		Log: func(r *unstructured.Unstructured, action apps.ResourceAction, status, msg string) {
 			if status == synk.StatusSuccess {
 				return
@@ -234,31 +509,56 @@ func (r *release) update(as *apps.ChartAssignment) {
 				r.GetName(), msg)
 		},
 	}
-	_, err = r.synk.Apply(context.Background(), as.Name, opts, resources...)
+	start := time.Now()
+	rs, err := r.synk.Apply(context.Background(), as.Name, opts, resources...)
 	if err != nil {
+		applyDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
 		r.recorder.Event(as, core.EventTypeWarning, "Failure", err.Error())
-		r.setFailed(err, synk.IsTransientErr(err))
+		r.setFailed(newApplyError(err, rs), synk.IsTransientErr(err))
 		return
 	}
+	applyDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
 	r.recorder.Event(as, core.EventTypeNormal, "Success", "chart updated successfully")
+
+	// Failing to record the manifests doesn't affect the release.
+	if r.kube != nil && r.manifestHistory > 0 {
+		m, err := storeManifests(r.kube, as, resources, r.manifestHistory)
+		if err != nil {
+			log.Printf("Failed to store manifests of %q: %s", as.Name, err)
+			r.recorder.Event(as, core.EventTypeWarning, "ManifestHistory", err.Error())
+		} else {
+			r.setManifests(m)
+		}
+	}
 	r.setPhase(apps.ChartAssignmentPhaseSettled)
 }
 
-func loadAndExpandChart(as *apps.ChartAssignment) ([]*unstructured.Unstructured, bool, error) {
-	c, values, err := loadChart(&as.Spec.Chart)
+// loadAndExpandChart loads the chart of the ChartAssignment and renders it
+// into resources. Charts with apiVersion v2 are rendered with Helm 3 and the
+// given capabilities of the cluster, which default to Helm's defaults if nil.
+// All other charts are rendered with Helm 2.
+// It returns true if the error may resolve by retrying.
+func loadAndExpandChart(as *apps.ChartAssignment, caps *chartutilv3.Capabilities, valuesFrom ...chartutil.Values) ([]*unstructured.Unstructured, bool, error) {
+	archive, err := fetchChart(&as.Spec.Chart)
 	if err != nil {
 		return nil, true, err
 	}
-	// Expand chart.
-	manifests, err := renderutil.Render(c, &chart.Config{Raw: values}, renderutil.Options{
-		ReleaseOptions: chartutil.ReleaseOptions{
-			Name:      as.Name,
-			Namespace: as.Spec.NamespaceName,
-			IsInstall: true,
-		},
-	})
+	apiVersion, err := chartAPIVersion(archive)
 	if err != nil {
-		return nil, false, errors.Wrap(err, "render chart")
+		return nil, true, &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "load chart metadata")}
+	}
+	var manifests map[string]string
+	if apiVersion == chartv3.APIVersionV2 {
+		manifests, err = expandChartV3(as, archive, caps, valuesFrom...)
+	} else {
+		manifests, err = expandChartV2(as, archive, valuesFrom...)
+	}
+	if err != nil {
+		// Errors that occur before rendering are retried, similar to
+		// fetching the chart.
+		se, ok := err.(*stageError)
+		retry := ok && (se.stage == apps.ChartAssignmentStageLoad || se.stage == apps.ChartAssignmentStageDependencies)
+		return nil, retry, err
 	}
 	// TODO: consider giving the synk package first-class support for raw manifests
 	// so that their decoding errors are fully surfaced in the ResourceSet. Otherwise,
@@ -270,30 +570,97 @@ func loadAndExpandChart(as *apps.ChartAssignment) ([]*unstructured.Unstructured,
 	return res, false, nil
 }
 
-func loadChart(cspec *apps.AssignedChart) (*chart.Chart, string, error) {
-	var archive io.Reader
-	var err error
-
+// fetchChart returns the archive of the inline chart or downloads it from
+// its repository.
+func fetchChart(cspec *apps.AssignedChart) ([]byte, error) {
 	if cspec.Inline != "" {
-		archive = base64.NewDecoder(base64.StdEncoding, strings.NewReader(cspec.Inline))
-	} else {
-		archive, err = fetchChartTar(cspec.Repository, cspec.Name, cspec.Version)
+		b, err := base64.StdEncoding.DecodeString(cspec.Inline)
+		if err != nil {
+			return nil, &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "decode inline chart")}
+		}
+		return b, nil
+	}
+	start := time.Now()
+	b, err := fetchChartTar(cspec.Repository, cspec.Name, cspec.Version)
+	chartFetchDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		chartFetchFailures.Inc()
+		return nil, &stageError{stage: apps.ChartAssignmentStageFetch, err: errors.Wrap(err, "retrieve chart")}
+	}
+	return b, nil
+}
+
+// chartAPIVersion returns the apiVersion from the Chart.yaml in a chart
+// archive.
+func chartAPIVersion(archive []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return "", errors.New("Chart.yaml not found")
+		} else if err != nil {
+			return "", err
+		}
+		// Skip the Chart.yaml files of dependencies in charts/.
+		parts := strings.Split(path.Clean(h.Name), "/")
+		if len(parts) != 2 || parts[1] != "Chart.yaml" {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
 		if err != nil {
-			return nil, "", errors.Wrap(err, "retrieve chart")
+			return "", err
+		}
+		var md struct {
+			APIVersion string `json:"apiVersion"`
 		}
+		if err := sigsyaml.Unmarshal(b, &md); err != nil {
+			return "", errors.Wrap(err, "parse Chart.yaml")
+		}
+		return md.APIVersion, nil
 	}
-	c, err := chartutil.LoadArchive(archive)
+}
+
+// expandChartV2 renders a chart with Helm 2.
+func expandChartV2(as *apps.ChartAssignment, archive []byte, valuesFrom ...chartutil.Values) (map[string]string, error) {
+	c, values, err := loadChart(archive, &as.Spec.Chart, valuesFrom...)
 	if err != nil {
-		return nil, "", errors.Wrap(err, "load chart archive")
+		return nil, err
+	}
+	manifests, err := renderutil.Render(c, &chart.Config{Raw: values}, renderutil.Options{
+		ReleaseOptions: chartutil.ReleaseOptions{
+			Name:      as.Name,
+			Namespace: as.Spec.NamespaceName,
+			IsInstall: true,
+		},
+	})
+	if err != nil {
+		return nil, newRenderError(errors.Wrap(err, "render chart"))
+	}
+	return manifests, nil
+}
+
+// loadChart loads the chart and its values with Helm 2. The chart's default
+// values are overridden by the valuesFrom in the given order and finally by
+// the inline values of the chart spec.
+func loadChart(archive []byte, cspec *apps.AssignedChart, valuesFrom ...chartutil.Values) (*chart.Chart, string, error) {
+	c, err := chartutil.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, "", &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "load chart archive")}
 	}
 
 	// Ensure charts in requirements.yaml are actually in packaged in.
 	if req, err := chartutil.LoadRequirements(c); err == nil {
 		if err := renderutil.CheckDependencies(c, req); err != nil {
-			return nil, "", errors.Wrap(err, "check chart dependencies")
+			return nil, "", &stageError{stage: apps.ChartAssignmentStageDependencies, err: errors.Wrap(err, "check chart dependencies")}
 		}
 	} else if err != chartutil.ErrRequirementsNotFound {
-		return nil, "", errors.Wrap(err, "load chart requirements")
+		return nil, "", &stageError{stage: apps.ChartAssignmentStageDependencies, err: errors.Wrap(err, "load chart requirements")}
 	}
 
 	// TODO: handle empty c.Values, cspec.Values
@@ -302,18 +669,21 @@ func loadChart(cspec *apps.AssignedChart) (*chart.Chart, string, error) {
 	// them explicitly.
 	vals, err := chartutil.ReadValues([]byte(c.Values.Raw))
 	if err != nil {
-		return nil, "", errors.Wrap(err, "reading chart values")
+		return nil, "", &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "reading chart values")}
+	}
+	for _, v := range valuesFrom {
+		vals.MergeInto(v) // Values from Secrets and ConfigMaps.
 	}
 	vals.MergeInto(chartutil.Values(cspec.Values)) // ChartAssignment values.
 
 	valsRaw, err := vals.YAML()
 	if err != nil {
-		return nil, "", errors.Wrap(err, "encode values")
+		return nil, "", &stageError{stage: apps.ChartAssignmentStageLoad, err: errors.Wrap(err, "encode values")}
 	}
 	return c, valsRaw, nil
 }
 
-func fetchChartTar(repoURL, name, version string) (io.Reader, error) {
+func fetchChartTar(repoURL, name, version string) ([]byte, error) {
 	c := downloader.ChartDownloader{
 		Getters: getter.Providers{
 			{Schemes: []string{"http", "https"}, New: newHTTPGetter},
@@ -346,11 +716,7 @@ func fetchChartTar(repoURL, name, version string) (io.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
-	b, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-	return bytes.NewReader(b), nil
+	return ioutil.ReadFile(filename)
 }
 
 // newHTTPGetter return a Helm chart getter for HTTP(s) repositories.
@@ -373,7 +739,11 @@ func decodeManifests(manifests map[string]string) (res []*unstructured.Unstructu
 			if err := dec.Decode(&u); err == io.EOF {
 				break
 			} else if err != nil {
-				return nil, errors.Wrapf(err, "decode manifest %d in %q", i, k)
+				return nil, &stageError{
+					stage:    apps.ChartAssignmentStageDecode,
+					template: k,
+					err:      errors.Wrapf(err, "decode manifest %d in %q", i, k),
+				}
 			}
 			res = append(res, &u)
 		}
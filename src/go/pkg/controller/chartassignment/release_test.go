@@ -1,13 +1,25 @@
 package chartassignment
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
 	"github.com/googlecloudrobotics/core/src/go/pkg/kubetest"
+	"github.com/googlecloudrobotics/core/src/go/pkg/synk"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/helm/pkg/chartutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 const (
@@ -22,6 +34,15 @@ func verifyValues(t *testing.T, have string, wantValues chartutil.Values) {
 	}
 }
 
+func decodeInlineChart(t *testing.T, inline string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(inline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
 func Test_loadChart_mergesValues(t *testing.T) {
 	var as apps.ChartAssignment
 	unmarshalYAML(t, &as, `
@@ -44,7 +65,37 @@ bar1: 3`)
 		"foo1": chartutil.Values{"baz1": "hello"},
 	}
 
-	_, vals, err := loadChart(&as.Spec.Chart)
+	_, vals, err := loadChart(decodeInlineChart(t, as.Spec.Chart.Inline), &as.Spec.Chart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyValues(t, vals, wantValues)
+}
+
+func Test_loadChart_mergesValuesFrom(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+      bar1: 5
+	`)
+	as.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName /*template=*/, "", `
+foo1:
+  baz1: "hello"
+bar1: 3`)
+	valuesFrom := []chartutil.Values{
+		{"bar1": 4, "foo1": map[string]interface{}{"baz2": "secret"}},
+		{"foo1": map[string]interface{}{"baz2": "config"}},
+	}
+	wantValues := chartutil.Values{
+		"bar1": 5,
+		"foo1": chartutil.Values{"baz1": "hello", "baz2": "config"},
+	}
+
+	_, vals, err := loadChart(decodeInlineChart(t, as.Spec.Chart.Inline), &as.Spec.Chart, valuesFrom...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,7 +112,7 @@ spec:
     values:
 	`)
 	as.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName /*template=*/, "", `foo: 1`)
-	resources, _, err := loadAndExpandChart(&as)
+	resources, _, err := loadAndExpandChart(&as, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,6 +122,282 @@ spec:
 
 }
 
+func Test_loadAndExpandChart_reportsTemplateLocation(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+	`)
+	as.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Values.foo | required "foo is required" }}
+`, ``)
+
+	_, _, err := loadAndExpandChart(&as, nil)
+	if err == nil {
+		t.Fatal("expected render error")
+	}
+	se, ok := err.(*stageError)
+	if !ok {
+		t.Fatalf("expected stage error, got %T: %s", err, err)
+	}
+	f := se.failure()
+	if f.Stage != apps.ChartAssignmentStageRender {
+		t.Errorf("unexpected stage %q", f.Stage)
+	}
+	if want := ChartName + "/templates/template.yaml"; f.Template != want || f.Line != 5 {
+		t.Errorf("want error in %s:5, got %s:%d (%s)", want, f.Template, f.Line, f.Message)
+	}
+}
+
+// buildHelm3Chart returns an inline apiVersion v2 chart that depends on a
+// library chart and an application chart, and has a values schema.
+func buildHelm3Chart(t *testing.T, extraDeps string) string {
+	return kubetest.BuildInlineChartFromFiles(t, map[string]string{
+		"app/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 0.0.1
+dependencies:
+- name: common
+  version: 0.0.1
+- name: sub
+  version: 0.0.1
+` + extraDeps,
+		"app/values.yaml": `
+replicas: 1
+sub:
+  greeting: hello
+`,
+		"app/values.schema.json": `{
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1}
+  }
+}`,
+		"app/templates/configmap.yaml": `
+{{ include "common.configmap" (dict "name" .Release.Name "replicas" .Values.replicas) }}
+`,
+		"app/charts/common/Chart.yaml": `
+apiVersion: v2
+name: common
+version: 0.0.1
+type: library
+`,
+		"app/charts/common/templates/_configmap.tpl": `
+{{- define "common.configmap" -}}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+data:
+  replicas: {{ .replicas | quote }}
+{{- end -}}
+`,
+		"app/charts/sub/Chart.yaml": `
+apiVersion: v2
+name: sub
+version: 0.0.1
+`,
+		"app/charts/sub/templates/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-sub
+data:
+  greeting: {{ .Values.greeting }}
+  kubeVersion: {{ .Capabilities.KubeVersion.Minor | quote }}
+`,
+	})
+}
+
+func Test_loadAndExpandChart_rendersHelm3Chart(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+      replicas: 2
+      sub:
+        greeting: hi
+	`)
+	as.Spec.Chart.Inline = buildHelm3Chart(t, "")
+
+	resources, _, err := loadAndExpandChart(&as, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]interface{}{
+		"test-assignment-1":     {"replicas": "2"},
+		"test-assignment-1-sub": {"greeting": "hi", "kubeVersion": "16"},
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("want %d resources, got %d", len(want), len(resources))
+	}
+	for _, r := range resources {
+		data, _, _ := unstructured.NestedMap(r.Object, "data")
+		if !reflect.DeepEqual(data, want[r.GetName()]) {
+			t.Errorf("unexpected data of %q: want %v, got %v", r.GetName(), want[r.GetName()], data)
+		}
+	}
+}
+
+func Test_loadAndExpandChart_validatesHelm3Values(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+      replicas: 0
+	`)
+	as.Spec.Chart.Inline = buildHelm3Chart(t, "")
+
+	_, retry, err := loadAndExpandChart(&as, nil)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if retry {
+		t.Error("expected validation error to not be retried")
+	}
+	if se, ok := err.(*stageError); !ok || se.stage != apps.ChartAssignmentStageValidate {
+		t.Errorf("expected error in stage %q, got %T: %s", apps.ChartAssignmentStageValidate, err, err)
+	}
+}
+
+func Test_loadAndExpandChart_failsOnMissingHelm3Dependency(t *testing.T) {
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+	`)
+	as.Spec.Chart.Inline = buildHelm3Chart(t, `
+- name: missing
+  version: 0.0.1
+`)
+
+	_, _, err := loadAndExpandChart(&as, nil)
+	if err == nil {
+		t.Fatal("expected dependency error")
+	}
+	if se, ok := err.(*stageError); !ok || se.stage != apps.ChartAssignmentStageDependencies {
+		t.Errorf("expected error in stage %q, got %T: %s", apps.ChartAssignmentStageDependencies, err, err)
+	}
+}
+
+// flakyDiscovery fails to get the server version while err is set.
+type flakyDiscovery struct {
+	discovery.DiscoveryInterface
+	err error
+}
+
+func (d *flakyDiscovery) ServerVersion() (*version.Info, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return d.DiscoveryInterface.ServerVersion()
+}
+
+func Test_capabilitiesCache_cachesUntilExpiredOrFailed(t *testing.T) {
+	fakeDiscovery := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	fakeDiscovery.FakedServerVersion = &version.Info{GitVersion: "v1.17.0", Major: "1", Minor: "17"}
+	dc := &flakyDiscovery{DiscoveryInterface: fakeDiscovery}
+	now := time.Unix(0, 0)
+	c := newCapabilitiesCache(dc)
+	c.now = func() time.Time { return now }
+
+	get := func() {
+		t.Helper()
+		caps, err := c.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if caps.KubeVersion.Version != "v1.17.0" {
+			t.Errorf("unexpected kube version %q", caps.KubeVersion.Version)
+		}
+	}
+	assertQueries := func(want int) {
+		t.Helper()
+		// Each discovery does a version, group and resource request.
+		if got := len(fakeDiscovery.Actions()) / 3; got != want {
+			t.Errorf("got %d discovery queries, want %d", got, want)
+		}
+	}
+
+	get()
+	get()
+	assertQueries(1)
+
+	now = now.Add(capabilitiesTTL)
+	get()
+	assertQueries(2)
+
+	now = now.Add(capabilitiesTTL)
+	dc.err = fmt.Errorf("unavailable")
+	if _, err := c.get(); err == nil {
+		t.Fatal("expected discovery error")
+	}
+	dc.err = nil
+	get()
+	assertQueries(3)
+}
+
+func Test_updateSynk_reportsFailedResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var as apps.ChartAssignment
+	unmarshalYAML(t, &as, `
+metadata:
+  name: test-assignment-1
+spec:
+  chart:
+    values:
+	`)
+	as.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName /*template=*/, "", `foo: 1`)
+
+	mockSynk := NewMockInterface(ctrl)
+	r := &release{
+		synk:     mockSynk,
+		recorder: &record.FakeRecorder{},
+	}
+
+	rs := &apps.ResourceSet{}
+	rs.Status.Failed = []apps.ResourceSetStatusGroup{{
+		Group:   "apps",
+		Version: "v1",
+		Kind:    "Deployment",
+		Items: []apps.ResourceStatus{
+			{Namespace: "foo", Name: "bar", Error: "invalid spec"},
+		},
+	}}
+	mockSynk.EXPECT().Apply(gomock.Any(), "test-assignment-1", gomock.Any(), gomock.Any()).Return(rs, fmt.Errorf("apply failed")).Times(1)
+
+	r.update(&as)
+
+	f := r.status.failure
+	if f == nil || f.Stage != apps.ChartAssignmentStageApply {
+		t.Fatalf("expected apply failure, got %+v", f)
+	}
+	want := []apps.ChartAssignmentFailedResource{
+		{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "foo", Name: "bar", Error: "invalid spec"},
+	}
+	if !reflect.DeepEqual(f.Resources, want) {
+		t.Errorf("unexpected failed resources: want %+v, got %+v", want, f.Resources)
+	}
+}
+
 func Test_updateSynk_callsApply(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -123,3 +450,248 @@ spec:
 	// First apply, the chart should be installed.
 	r.delete(&as)
 }
+
+func newRollbackTestAssignments(t *testing.T) (good, bad *apps.ChartAssignment) {
+	good, bad = &apps.ChartAssignment{}, &apps.ChartAssignment{}
+	unmarshalYAML(t, good, `
+metadata:
+  name: test-assignment-1
+  generation: 1
+spec:
+  rollback:
+    deadlineSeconds: 60
+	`)
+	good.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName /*template=*/, "", `foo: 1`)
+	unmarshalYAML(t, bad, `
+metadata:
+  name: test-assignment-1
+  generation: 2
+spec:
+  rollback:
+    deadlineSeconds: 60
+	`)
+	bad.Spec.Chart.Inline = kubetest.BuildInlineChart(t, ChartName /*template=*/, "", `foo: 2`)
+	return good, bad
+}
+
+func Test_ensureRolledBack_appliesLastReadyGeneration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	good, bad := newRollbackTestAssignments(t)
+
+	mockSynk := NewMockInterface(ctrl)
+	rs := &releases{
+		synk:     mockSynk,
+		recorder: &record.FakeRecorder{},
+		m:        map[string]*release{},
+	}
+	rs.setReady(good)
+
+	r := rs.add(bad.Name)
+	r.generation = bad.Generation
+	r.updated = time.Now()
+	r.setFailed(fmt.Errorf("apply failed"), false)
+
+	applied := make(chan struct{})
+	mockSynk.EXPECT().Apply(gomock.Any(), "test-assignment-1", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ *synk.ApplyOptions, _ ...*unstructured.Unstructured) (*apps.ResourceSet, error) {
+			close(applied)
+			return &apps.ResourceSet{}, nil
+		}).Times(1)
+
+	// The worker goroutine may not be receiving yet, retry like the
+	// reconciler would.
+	for i := 0; !rs.ensureRolledBack(bad, apps.ChartAssignmentPhaseFailed); i++ {
+		if i == 100 {
+			t.Fatal("expected rollback to be started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-applied:
+	case <-time.After(10 * time.Second):
+		t.Fatal("last Ready generation was not applied")
+	}
+	status, _ := rs.status(bad.Name)
+	if status.rollback == nil {
+		t.Fatal("expected rollback status to be set")
+	}
+	if status.rollback.FailedGeneration != 2 || status.rollback.RestoredGeneration != 1 {
+		t.Errorf("unexpected rollback status %+v", status.rollback)
+	}
+	// A second call must not roll back again.
+	if rs.ensureRolledBack(bad, apps.ChartAssignmentPhaseFailed) {
+		t.Error("expected no second rollback")
+	}
+}
+
+func Test_ensureRolledBack_waitsForDeadline(t *testing.T) {
+	good, bad := newRollbackTestAssignments(t)
+
+	rs := &releases{
+		recorder: &record.FakeRecorder{},
+		m:        map[string]*release{},
+	}
+	rs.setReady(good)
+
+	r := rs.add(bad.Name)
+	r.generation = bad.Generation
+	r.updated = time.Now()
+	r.setPhase(apps.ChartAssignmentPhaseSettled)
+
+	if rs.ensureRolledBack(bad, apps.ChartAssignmentPhaseSettled) {
+		t.Error("expected no rollback before the deadline")
+	}
+	bad.Spec.Rollback = nil
+	r.updated = time.Now().Add(-time.Hour)
+	if rs.ensureRolledBack(bad, apps.ChartAssignmentPhaseSettled) {
+		t.Error("expected no rollback if rollback is disabled")
+	}
+}
+
+func Test_release_notifiesAfterUpdate(t *testing.T) {
+	events := make(chan event.GenericEvent, 1)
+	rs := &releases{
+		recorder: &record.FakeRecorder{},
+		events:   events,
+		m:        map[string]*release{},
+	}
+	r := rs.add("test-assignment-1")
+
+	// The worker goroutine may not be receiving yet.
+	for i := 0; !r.start(func() { r.setPhase(apps.ChartAssignmentPhaseSettled) }); i++ {
+		if i == 100 {
+			t.Fatal("expected function to be started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case e := <-events:
+		if e.Meta.GetName() != "test-assignment-1" {
+			t.Errorf("unexpected event for %q", e.Meta.GetName())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected event after update")
+	}
+
+	// Retried errors must not trigger an event.
+	for !r.start(func() { r.setFailed(fmt.Errorf("conflict"), true) }) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Wait for the worker to finish by starting a no-op.
+	for !r.start(func() {}) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-events:
+		t.Error("unexpected event after retriable error")
+	default:
+	}
+}
+
+func noValuesFrom(*apps.ChartAssignment) ([]chartutil.Values, error) { return nil, nil }
+
+func Test_ensureRolledBack_restoresLastReadyFromStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	good, bad := newRollbackTestAssignments(t)
+	bad.Status.LastReady = &apps.ChartAssignmentLastReady{
+		Generation: good.Generation,
+		Spec:       good.Spec,
+	}
+
+	// A new release cache, as after a restart of the controller.
+	mockSynk := NewMockInterface(ctrl)
+	rs := &releases{
+		synk:     mockSynk,
+		recorder: &record.FakeRecorder{},
+		m:        map[string]*release{},
+	}
+	if err := rs.restoreLastReady(bad, noValuesFrom); err != nil {
+		t.Fatal(err)
+	}
+
+	r := rs.add(bad.Name)
+	r.generation = bad.Generation
+	r.updated = time.Now()
+	r.setFailed(fmt.Errorf("apply failed"), false)
+
+	applied := make(chan struct{})
+	mockSynk.EXPECT().Apply(gomock.Any(), "test-assignment-1", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, _ *synk.ApplyOptions, _ ...*unstructured.Unstructured) (*apps.ResourceSet, error) {
+			close(applied)
+			return &apps.ResourceSet{}, nil
+		}).Times(1)
+
+	for i := 0; !rs.ensureRolledBack(bad, apps.ChartAssignmentPhaseFailed); i++ {
+		if i == 100 {
+			t.Fatal("expected rollback to be started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-applied:
+	case <-time.After(10 * time.Second):
+		t.Fatal("last Ready generation was not applied")
+	}
+	status, _ := rs.status(bad.Name)
+	if status.rollback == nil || status.rollback.RestoredGeneration != good.Generation {
+		t.Errorf("unexpected rollback status %+v", status.rollback)
+	}
+}
+
+func Test_restoreLastReady_keepsRollback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	good, bad := newRollbackTestAssignments(t)
+	bad.Status.LastReady = &apps.ChartAssignmentLastReady{
+		Generation: good.Generation,
+		Spec:       good.Spec,
+	}
+	bad.Status.Rollback = &apps.ChartAssignmentRollbackStatus{
+		FailedGeneration:   bad.Generation,
+		RestoredGeneration: good.Generation,
+	}
+
+	mockSynk := NewMockInterface(ctrl)
+	mockSynk.EXPECT().Apply(gomock.Any(), "test-assignment-1", gomock.Any(), gomock.Any()).
+		Return(&apps.ResourceSet{}, nil).AnyTimes()
+	rs := &releases{
+		synk:     mockSynk,
+		recorder: &record.FakeRecorder{},
+		m:        map[string]*release{},
+	}
+	lastValuesFrom := []chartutil.Values{{"bar": "baz"}}
+	err := rs.restoreLastReady(bad, func(*apps.ChartAssignment) ([]chartutil.Values, error) {
+		return lastValuesFrom, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rs.add(bad.Name)
+	if r.lastReady == nil || r.lastReady.Generation != good.Generation {
+		t.Fatalf("expected generation %d to be restored, got %v", good.Generation, r.lastReady)
+	}
+	if !reflect.DeepEqual(r.lastReadyValuesFrom, lastValuesFrom) {
+		t.Errorf("expected valuesFrom %v to be restored, got %v", lastValuesFrom, r.lastReadyValuesFrom)
+	}
+	// The first update after the restart applies the last Ready generation
+	// again and keeps the rollback.
+	for i := 0; !rs.ensureUpdated(bad, nil); i++ {
+		if i == 100 {
+			t.Fatal("expected update to be started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	status, _ := rs.status(bad.Name)
+	if status.rollback == nil || status.rollback.FailedGeneration != bad.Generation {
+		t.Errorf("expected rollback to be kept, got %+v", status.rollback)
+	}
+	if ready := rs.setReady(bad); ready {
+		t.Error("expected rolled back generation not to be recorded as Ready")
+	}
+}
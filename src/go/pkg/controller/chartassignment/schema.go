@@ -0,0 +1,208 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	chartv3 "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	chartutilv3 "helm.sh/helm/v3/pkg/chartutil"
+)
+
+const (
+	// fetchTimeout bounds how long admission waits for a chart to be
+	// downloaded from its repository.
+	fetchTimeout = 5 * time.Second
+	// maxCachedArchives bounds the number of charts kept for validation.
+	maxCachedArchives = 32
+)
+
+// chartArchives caches the archives of charts fetched from repositories for
+// validation. A chart version in a repository is expected to not change.
+var chartArchives = newArchiveCache(maxCachedArchives)
+
+// archiveCache is a least-recently-used cache of chart archives.
+type archiveCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *archiveEntry, most recently used first.
+	m     map[string]*list.Element
+}
+
+type archiveEntry struct {
+	key     string
+	archive []byte
+}
+
+func newArchiveCache(size int) *archiveCache {
+	return &archiveCache{size: size, order: list.New(), m: map[string]*list.Element{}}
+}
+
+func (c *archiveCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*archiveEntry).archive, true
+}
+
+// add adds or refreshes an archive and evicts the least recently used one
+// if the cache is full.
+func (c *archiveCache) add(key string, archive []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.m[key]; ok {
+		e.Value.(*archiveEntry).archive = archive
+		c.order.MoveToFront(e)
+		return
+	}
+	c.m[key] = c.order.PushFront(&archiveEntry{key: key, archive: archive})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.m, oldest.Value.(*archiveEntry).key)
+	}
+}
+
+// ValidateValues validates the values of a chart against its
+// values.schema.json and the ones of its dependencies. Only charts with
+// apiVersion v2 have a schema.
+//
+// Values from Secrets and ConfigMaps are not known at admission time, so
+// charts with valuesFrom are not validated. Neither are charts that cannot
+// be fetched from their repository in time; they are validated when they
+// are rendered.
+func ValidateValues(cspec *apps.AssignedChart, fldPath *field.Path) field.ErrorList {
+	if len(cspec.ValuesFrom) > 0 {
+		return nil
+	}
+	archive, err := fetchChartForValidation(cspec)
+	if err != nil {
+		log.Printf("Skipping values validation of chart %q: %s", cspec.Name, err)
+		return nil
+	}
+	apiVersion, err := chartAPIVersion(archive)
+	if err != nil || apiVersion != chartv3.APIVersionV2 {
+		return nil
+	}
+	c, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil
+	}
+	vals := chartutilv3.Values{}
+	mergeValuesV3(vals, cspec.Values)
+
+	// Like rendering, skip the schemas of disabled dependencies.
+	if err := chartutilv3.ProcessDependencies(c, vals); err != nil {
+		return nil
+	}
+	coalesced, err := chartutilv3.CoalesceValues(c, vals)
+	if err != nil {
+		return nil
+	}
+	return validateAgainstSchema(c, coalesced, fldPath)
+}
+
+// fetchChartForValidation returns the archive of an inline chart or fetches
+// the chart from its repository. If fetching takes longer than fetchTimeout,
+// it gives up but caches the chart for later validations once downloaded.
+func fetchChartForValidation(cspec *apps.AssignedChart) ([]byte, error) {
+	if cspec.Inline != "" {
+		return fetchChart(cspec)
+	}
+	key := fmt.Sprintf("%s/%s:%s", cspec.Repository, cspec.Name, cspec.Version)
+
+	if b, ok := chartArchives.get(key); ok {
+		return b, nil
+	}
+
+	type result struct {
+		b   []byte
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		b, err := fetchChart(cspec)
+		if err == nil {
+			chartArchives.add(key, b)
+		}
+		c <- result{b, err}
+	}()
+	select {
+	case r := <-c:
+		return r.b, r.err
+	case <-time.After(fetchTimeout):
+		return nil, errors.New("timed out fetching chart")
+	}
+}
+
+// validateAgainstSchema validates the coalesced values against the schema of
+// the chart and recursively against the ones of its dependencies.
+func validateAgainstSchema(c *chartv3.Chart, vals map[string]interface{}, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(c.Schema) > 0 {
+		res, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(c.Schema), gojsonschema.NewGoLoader(vals))
+		if err != nil {
+			errs = append(errs, field.InternalError(fldPath, errors.Wrapf(err, "load values.schema.json of chart %q", c.Name())))
+		} else {
+			for _, re := range res.Errors() {
+				p := schemaFieldPath(fldPath, re.Field())
+				if prop, ok := re.Details()["property"].(string); ok && re.Type() == "required" {
+					errs = append(errs, field.Required(p.Child(prop), ""))
+				} else {
+					errs = append(errs, field.Invalid(p, re.Value(), re.Description()))
+				}
+			}
+		}
+	}
+	for _, dep := range c.Dependencies() {
+		if dv, ok := vals[dep.Name()].(map[string]interface{}); ok {
+			errs = append(errs, validateAgainstSchema(dep, dv, fldPath.Child(dep.Name()))...)
+		}
+	}
+	return errs
+}
+
+// schemaFieldPath converts a field of a JSON schema error, e.g. "a.b.0", to
+// a field path relative to the given one.
+func schemaFieldPath(fldPath *field.Path, f string) *field.Path {
+	if f == gojsonschema.STRING_CONTEXT_ROOT {
+		return fldPath
+	}
+	for _, k := range strings.Split(f, ".") {
+		if i, err := strconv.Atoi(k); err == nil {
+			fldPath = fldPath.Index(i)
+		} else {
+			fldPath = fldPath.Child(k)
+		}
+	}
+	return fldPath
+}
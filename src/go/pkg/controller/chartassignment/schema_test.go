@@ -0,0 +1,124 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"testing"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/googlecloudrobotics/core/src/go/pkg/kubetest"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateValues(t *testing.T) {
+	helm3Chart := buildHelm3Chart(t, "")
+	helm2Chart := kubetest.BuildInlineChart(t, ChartName /*template=*/, "", "replicas: 1")
+
+	cases := []struct {
+		desc  string
+		chart apps.AssignedChart
+		want  []string
+	}{
+		{
+			desc: "valid values",
+			chart: apps.AssignedChart{
+				Inline: helm3Chart,
+				Values: apps.ConfigValues{"replicas": 2},
+			},
+		},
+		{
+			desc: "invalid values",
+			chart: apps.AssignedChart{
+				Inline: helm3Chart,
+				Values: apps.ConfigValues{"replicas": 0},
+			},
+			want: []string{"spec.chart.values.replicas"},
+		},
+		{
+			desc: "wrong type",
+			chart: apps.AssignedChart{
+				Inline: helm3Chart,
+				Values: apps.ConfigValues{"replicas": "two"},
+			},
+			want: []string{"spec.chart.values.replicas"},
+		},
+		{
+			desc: "valuesFrom are not validated",
+			chart: apps.AssignedChart{
+				Inline: helm3Chart,
+				Values: apps.ConfigValues{"replicas": 0},
+				ValuesFrom: []apps.ValuesFromSource{
+					{Kind: apps.ValuesFromSourceConfigMap, Name: "values"},
+				},
+			},
+		},
+		{
+			desc: "helm 2 charts have no schema",
+			chart: apps.AssignedChart{
+				Inline: helm2Chart,
+				Values: apps.ConfigValues{"replicas": 0},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			errs := ValidateValues(&c.chart, field.NewPath("spec", "chart", "values"))
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Field)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("want errors for %v, got %v", c.want, errs)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Errorf("want error for %s, got %v", c.want[i], errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaFieldPath(t *testing.T) {
+	base := field.NewPath("spec", "values")
+	cases := map[string]string{
+		"(root)":     "spec.values",
+		"replicas":   "spec.values.replicas",
+		"ports.0":    "spec.values.ports[0]",
+		"a.b.1.name": "spec.values.a.b[1].name",
+	}
+	for in, want := range cases {
+		if got := schemaFieldPath(base, in).String(); got != want {
+			t.Errorf("schemaFieldPath(%q): want %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestArchiveCache_evictsLeastRecentlyUsed(t *testing.T) {
+	c := newArchiveCache(2)
+	c.add("a", []byte("a"))
+	c.add("b", []byte("b"))
+	// Using "a" makes "b" the least recently used archive.
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.add("c", []byte("c"))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%q): want cached=%v, got %v", key, want, ok)
+		}
+	}
+}
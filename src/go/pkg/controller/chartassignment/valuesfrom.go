@@ -0,0 +1,184 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// valuesFromSyncTimeout bounds how long loading a valuesFrom source waits
+// for the initial list of its watch.
+const valuesFromSyncTimeout = 30 * time.Second
+
+// valuesFromSources watches the Secrets and ConfigMaps referenced in the
+// valuesFrom of ChartAssignments. Each of them is watched on its own with a
+// field selector on its name, so that the controller doesn't cache all
+// Secrets and ConfigMaps of the cluster. A generic event for the source is
+// sent to events whenever it changes.
+type valuesFromSources struct {
+	kube   kubernetes.Interface
+	events chan<- event.GenericEvent
+
+	mu        sync.Mutex
+	informers map[string]*valuesFromInformer // By valuesFromKey.
+	refs      map[string][]string            // Referenced keys by ChartAssignment.
+}
+
+type valuesFromInformer struct {
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+}
+
+func newValuesFromSources(kube kubernetes.Interface, events chan<- event.GenericEvent) *valuesFromSources {
+	return &valuesFromSources{
+		kube:      kube,
+		events:    events,
+		informers: map[string]*valuesFromInformer{},
+		refs:      map[string][]string{},
+	}
+}
+
+// get returns the Secret or ConfigMap from the source's watch, which is
+// started if the source isn't watched yet. It returns nil if the source
+// doesn't exist.
+func (s *valuesFromSources) get(kind apps.ValuesFromSourceKind, namespace, name string) (runtime.Object, error) {
+	inf, err := s.watch(kind, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	err = wait.PollImmediate(100*time.Millisecond, valuesFromSyncTimeout, func() (bool, error) {
+		return inf.informer.HasSynced(), nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "wait for watch of %s %s/%s", kind, namespace, name)
+	}
+	obj, exists, err := inf.informer.GetStore().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return obj.(runtime.Object), nil
+}
+
+func (s *valuesFromSources) watch(kind apps.ValuesFromSourceKind, namespace, name string) (*valuesFromInformer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := valuesFromKey(kind, namespace, name)
+	if inf, ok := s.informers[key]; ok {
+		return inf, nil
+	}
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+
+	var (
+		lw  *cache.ListWatch
+		obj runtime.Object
+	)
+	switch kind {
+	case apps.ValuesFromSourceSecret:
+		secrets := s.kube.CoreV1().Secrets(namespace)
+		lw = &cache.ListWatch{
+			ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+				opts.FieldSelector = selector
+				return secrets.List(opts)
+			},
+			WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+				opts.FieldSelector = selector
+				return secrets.Watch(opts)
+			},
+		}
+		obj = &core.Secret{}
+	case apps.ValuesFromSourceConfigMap:
+		configMaps := s.kube.CoreV1().ConfigMaps(namespace)
+		lw = &cache.ListWatch{
+			ListFunc: func(opts meta.ListOptions) (runtime.Object, error) {
+				opts.FieldSelector = selector
+				return configMaps.List(opts)
+			},
+			WatchFunc: func(opts meta.ListOptions) (watch.Interface, error) {
+				opts.FieldSelector = selector
+				return configMaps.Watch(opts)
+			},
+		}
+		obj = &core.ConfigMap{}
+	default:
+		return nil, errors.Errorf("unknown valuesFrom kind %q", kind)
+	}
+	inf := &valuesFromInformer{
+		informer: cache.NewSharedIndexInformer(lw, obj, 0, cache.Indexers{}),
+		stop:     make(chan struct{}),
+	}
+	// The event only identifies the source, the ChartAssignments that
+	// reference it are looked up when handling it.
+	notify := func() {
+		src := obj.DeepCopyObject()
+		m := src.(meta.Object)
+		m.SetNamespace(namespace)
+		m.SetName(name)
+		s.events <- event.GenericEvent{Meta: m, Object: src}
+	}
+	inf.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	go inf.informer.Run(inf.stop)
+
+	s.informers[key] = inf
+	return inf, nil
+}
+
+// setReferences records the keys of the sources referenced by the named
+// ChartAssignment. It returns true if they changed since the last call.
+func (s *valuesFromSources) setReferences(as string, keys []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reflect.DeepEqual(s.refs[as], keys) {
+		return false
+	}
+	if len(keys) == 0 {
+		delete(s.refs, as)
+	} else {
+		s.refs[as] = keys
+	}
+	return true
+}
+
+// prune stops the watches of sources that are no longer referenced.
+func (s *valuesFromSources) prune(referenced func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, inf := range s.informers {
+		if !referenced(key) {
+			close(inf.stop)
+			delete(s.informers, key)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Cloud Robotics Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chartassignment
+
+import (
+	"testing"
+	"time"
+
+	apps "github.com/googlecloudrobotics/core/src/go/pkg/apis/apps/v1alpha1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestValuesFromSources(t *testing.T) {
+	kube := fake.NewSimpleClientset(&core.Secret{
+		ObjectMeta: meta.ObjectMeta{Namespace: "app-foo", Name: "credentials"},
+		Data:       map[string][]byte{"values.yaml": []byte("a: 1")},
+	})
+	events := make(chan event.GenericEvent, 10)
+	s := newValuesFromSources(kube, events)
+	defer s.prune(func(string) bool { return false })
+
+	obj, err := s.get(apps.ValuesFromSourceSecret, "app-foo", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, ok := obj.(*core.Secret); !ok || string(secret.Data["values.yaml"]) != "a: 1" {
+		t.Fatalf("unexpected object %v", obj)
+	}
+	obj, err = s.get(apps.ValuesFromSourceConfigMap, "app-foo", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj != nil {
+		t.Fatalf("expected nil for missing ConfigMap, got %v", obj)
+	}
+	if len(s.informers) != 2 {
+		t.Errorf("expected 2 watched sources, got %d", len(s.informers))
+	}
+
+	// Updates of a watched source are sent as events for the source.
+	_, err = kube.CoreV1().ConfigMaps("app-foo").Create(&core.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{Namespace: "app-foo", Name: "missing"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * time.Second)
+	for created := false; !created; {
+		select {
+		case e := <-events:
+			_, ok := e.Object.(*core.ConfigMap)
+			created = ok && e.Meta.GetName() == "missing"
+		case <-timeout:
+			t.Fatal("no event for created ConfigMap")
+		}
+	}
+	secretKey := valuesFromKey(apps.ValuesFromSourceSecret, "app-foo", "credentials")
+	s.prune(func(key string) bool { return key == secretKey })
+
+	if _, ok := s.informers[secretKey]; !ok || len(s.informers) != 1 {
+		t.Errorf("expected only %q to be watched after prune, got %v", secretKey, s.informers)
+	}
+}
+
+func TestValuesFromSources_setReferences(t *testing.T) {
+	s := newValuesFromSources(fake.NewSimpleClientset(), make(chan event.GenericEvent))
+	keys := []string{valuesFromKey(apps.ValuesFromSourceSecret, "app-foo", "credentials")}
+
+	if s.setReferences("foo", nil) {
+		t.Error("expected no change without references")
+	}
+	if !s.setReferences("foo", keys) {
+		t.Error("expected change for new references")
+	}
+	if s.setReferences("foo", keys) {
+		t.Error("expected no change for the same references")
+	}
+	// A deleted ChartAssignment references no sources.
+	if !s.setReferences("foo", nil) {
+		t.Error("expected change for removed references")
+	}
+	if len(s.refs) != 0 {
+		t.Errorf("expected no references left, got %v", s.refs)
+	}
+}
+
+func TestValuesFromSources_unknownKind(t *testing.T) {
+	s := newValuesFromSources(fake.NewSimpleClientset(), make(chan event.GenericEvent))
+	if _, err := s.get("Pod", "app-foo", "foo"); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"os/exec"
 	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 	"text/template"
@@ -321,6 +322,32 @@ func BuildInlineChart(t *testing.T, name, tmpl, values string) string {
 	return encoded.String()
 }
 
+// BuildInlineChartFromFiles creates an inline chart string from the given
+// files, keyed by their path in the archive, e.g. "mychart/Chart.yaml".
+func BuildInlineChartFromFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var encoded bytes.Buffer
+	bw := base64.NewEncoder(base64.StdEncoding, &encoded)
+	zw := gzip.NewWriter(bw)
+	tw := tar.NewWriter(zw)
+	for _, p := range paths {
+		if err := addFileToTar(tw, p, files[p]); err != nil {
+			t.Fatalf("Failed to add %s to tarball: %s", p, err)
+		}
+	}
+	tw.Close()
+	zw.Close()
+	bw.Close()
+	return encoded.String()
+}
+
 func addFileToTar(tw *tar.Writer, path, content string) error {
 	if err := tw.WriteHeader(&tar.Header{
 		Name: path,
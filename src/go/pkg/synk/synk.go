@@ -103,8 +103,11 @@ type ApplyOptions struct {
 	// other namespace set yet.
 	Namespace string
 	// EnforceNamespace causes apply to fail if a resource has a namespace set
-	// that's different from Namespace.
+	// that's different from Namespace, "kube-system", and AllowedNamespaces.
 	EnforceNamespace bool
+	// AllowedNamespaces are namespaces resources may be in besides Namespace
+	// if EnforceNamespace is set.
+	AllowedNamespaces []string
 
 	// Log functions to report progress and failures while applying resources.
 	Log func(r *unstructured.Unstructured, a apps.ResourceAction, status, msg string)
@@ -423,9 +426,10 @@ func (s *Synk) initialize(
 	// TODO: consider putting this and other validation as a step after initialize
 	// so we can give validation errors in batch in the ResourceSet status.
 	if opts.EnforceNamespace {
+		allowed := append([]string{opts.Namespace, "kube-system"}, opts.AllowedNamespaces...)
 		for _, r := range regulars {
-			if ns := r.GetNamespace(); ns != "" && ns != opts.Namespace && ns != "kube-system" {
-				return nil, nil, errors.Errorf("invalid namespace %q on %q, expected %q or \"kube-system\"", ns, resourceKey(r), opts.Namespace)
+			if ns := r.GetNamespace(); ns != "" && !stringsContain(allowed, ns) {
+				return nil, nil, errors.Errorf("invalid namespace %q on %q, expected one of %q", ns, resourceKey(r), allowed)
 			}
 		}
 	}
@@ -1012,6 +1016,15 @@ func filter(in []*unstructured.Unstructured, f func(*unstructured.Unstructured)
 	return out
 }
 
+func stringsContain(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 func resourceSetName(s string, v int32) string {
 	return fmt.Sprintf("%s.v%d", s, v)
 }
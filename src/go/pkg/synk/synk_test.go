@@ -209,6 +209,40 @@ status:
 	}
 }
 
+func TestSynk_initializeEnforcesNamespace(t *testing.T) {
+	cases := []struct {
+		name      string
+		namespace string
+		ok        bool
+	}{
+		{name: "default-namespace", namespace: "ns1", ok: true},
+		{name: "kube-system", namespace: "kube-system", ok: true},
+		{name: "allowed-namespace", namespace: "monitoring", ok: true},
+		{name: "other-namespace", namespace: "ns2", ok: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newFixture(t).newSynk()
+
+			_, _, err := s.initialize(context.Background(), &ApplyOptions{
+				name:              "test",
+				Namespace:         "ns1",
+				EnforceNamespace:  true,
+				AllowedNamespaces: []string{"monitoring"},
+			},
+				newUnstructured("v1", "Pod", c.namespace, "pod1"),
+				newUnstructured("v1", "Namespace", "", "ns3"),
+			)
+			if c.ok && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !c.ok && err == nil {
+				t.Errorf("expected error for namespace %q", c.namespace)
+			}
+		})
+	}
+}
+
 func TestSynk_updateResourceSetStatus(t *testing.T) {
 	f := newFixture(t)
 	s := f.newSynk()
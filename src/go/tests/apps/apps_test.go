@@ -147,6 +147,7 @@ func TestAll(t *testing.T) {
 		testCreateChartAssignment_WithBadDeployment_BecomesFailed,
 		testUpdateChartAssignment_WithFixedDeployment_BecomesReady,
 		testUpdateChartAssignment_WithFixedJob_BecomesReady,
+		testUnpauseChartAssignment_BecomesReady,
 	)
 }
 
@@ -351,3 +352,58 @@ func testUpdateChartAssignment_WithFixedJob_BecomesReady(t *testing.T, f *kubete
 		t.Fatalf("wait for chart assignment to go from Settled to Ready: %s", err)
 	}
 }
+
+func testUnpauseChartAssignment_BecomesReady(t *testing.T, f *kubetest.Fixture) {
+	robot := f.Client(robotClusterName)
+
+	// First, create a paused ChartAssignment and verify that it isn't applied.
+	data := map[string]string{
+		"cluster":   robotClusterName,
+		"name":      f.Uniq("example"),
+		"namespace": f.Uniq("ns"),
+		"chart":     kubetest.BuildInlineChart(t, "example", goodDeployment /*values=*/, ""),
+	}
+	var ca crcapps.ChartAssignment
+	f.FromYAML(inlineChartTemplate, data, &ca)
+	ca.Spec.Paused = true
+
+	if err := robot.Create(f.Ctx(), &ca); err != nil {
+		t.Fatalf("create ChartAssignment: %s", err)
+	}
+
+	if err := backoff.Retry(
+		f.ChartAssignmentHasStatus(&ca, crcapps.ChartAssignmentPhasePaused),
+		backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 60),
+	); err != nil {
+		t.Fatalf("wait for chart assignment to be paused: %s", err)
+	}
+	var dep apps.Deployment
+	err := robot.Get(f.Ctx(), client.ObjectKey{Namespace: data["namespace"], Name: "test"}, &dep)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected no deployment for paused ChartAssignment, got error %v", err)
+	}
+
+	// Next, unpause the ChartAssignment and wait for it to become ready.
+	if err := backoff.Retry(func() error {
+		if err := robot.Get(f.Ctx(), f.ObjectKey(&ca), &ca); err != nil {
+			return backoff.Permanent(err)
+		}
+		ca.Spec.Paused = false
+		if err := robot.Update(f.Ctx(), &ca); apierrors.IsConflict(err) {
+			return err
+		} else if err != nil {
+			return backoff.Permanent(err)
+		}
+		return nil
+	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 60),
+	); err != nil {
+		t.Fatalf("update ChartAssignment: %s %s", apierrors.ReasonForError(err), err)
+	}
+
+	if err := backoff.Retry(
+		f.ChartAssignmentHasStatus(&ca, crcapps.ChartAssignmentPhaseReady),
+		backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Second), 60),
+	); err != nil {
+		t.Fatalf("wait for chart assignment to go from Paused to Ready: %s", err)
+	}
+}